@@ -1,17 +1,22 @@
 package app
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
 )
 
 type ActivityType struct {
@@ -56,6 +61,168 @@ func (a *ActivityType) CallHttp(ctx context.Context, step *Step) (string, error)
 	return result, nil
 }
 
+// Generic http call used by http.post/put/patch/delete/request. Args are decoded into Args_Http and the result is a
+// JSON object: { status, ok, headers, body } where body is parsed JSON when possible. Statuses in args.RetryOn fail
+// with a retryable HttpError instead, the result object is its details
+func (a *ActivityType) HttpRequest(ctx context.Context, step *Step) (string, error) {
+	var args Args_Http
+	bs, err := json.Marshal(step.Args)
+	if err != nil {
+		return "", err
+	}
+	err = json.Unmarshal(bs, &args)
+	if err != nil {
+		return "", temporal.NewNonRetryableApplicationError("HttpRequest: invalid args: "+err.Error(), ERROR_KIND_ARGS, nil)
+	}
+
+	if args.Url == "" {
+		return "", temporal.NewNonRetryableApplicationError("URL was not provided for HttpRequest", ERROR_KIND_ARGS, nil)
+	}
+
+	// http.post => POST, http.request => args.method
+	method := strings.ToUpper(strings.TrimPrefix(step.Call, "http."))
+	if step.Call == "http.request" {
+		method = strings.ToUpper(args.Method)
+		if method == "" {
+			method = http.MethodGet
+		}
+	}
+
+	u, err := url.Parse(args.Url)
+	if err != nil {
+		return "", temporal.NewNonRetryableApplicationError("HttpRequest: invalid url: "+err.Error(), ERROR_KIND_ARGS, nil)
+	}
+	q := u.Query()
+	for k, v := range args.Query {
+		q.Set(k, toString(v))
+	}
+	u.RawQuery = q.Encode()
+
+	contentType := ""
+	for k, v := range args.Headers {
+		if strings.EqualFold(k, "Content-Type") {
+			contentType = v
+		}
+	}
+
+	var body io.Reader
+	form, isForm := args.Body.(map[string]interface{})
+	isForm = isForm && strings.Contains(contentType, "application/x-www-form-urlencoded")
+	if raw, ok := args.Body.(string); ok {
+		body = strings.NewReader(raw)
+	} else if isForm {
+		values := url.Values{}
+		for k, v := range form {
+			values.Set(k, toString(v))
+		}
+		body = strings.NewReader(values.Encode())
+	} else if args.Body != nil {
+		bs, err := json.Marshal(args.Body)
+		if err != nil {
+			return "", err
+		}
+		body = bytes.NewReader(bs)
+		if contentType == "" {
+			contentType = "application/json"
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range args.Headers {
+		req.Header.Set(k, v)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	// "Bearer xyz" as is, "user:password" as basic auth, anything else as a bearer token
+	if args.Auth != "" {
+		if strings.Contains(args.Auth, " ") {
+			req.Header.Set("Authorization", args.Auth)
+		} else if i := strings.Index(args.Auth, ":"); i >= 0 {
+			req.SetBasicAuth(args.Auth[:i], args.Auth[i+1:])
+		} else {
+			req.Header.Set("Authorization", "Bearer "+args.Auth)
+		}
+	}
+
+	client := &http.Client{}
+	if args.Timeout > 0 {
+		client.Timeout = time.Duration(args.Timeout) * time.Second
+	}
+
+	log.Println("HttpRequest: ", method, u.String())
+	res, err := client.Do(req)
+	if err != nil {
+		log.Println(err)
+		return "", temporal.NewApplicationErrorWithCause("HttpRequest: "+method+" "+u.String()+" failed", ERROR_KIND_HTTP, err)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+
+	headers := make(map[string]string)
+	for k, v := range res.Header {
+		headers[k] = strings.Join(v, ", ")
+	}
+
+	var parsed interface{} = string(data)
+	if len(data) > 0 && IsJSON(string(data)) {
+		json.Unmarshal(data, &parsed)
+	}
+
+	response := map[string]interface{}{
+		"status":  res.StatusCode,
+		"ok":      res.StatusCode >= 200 && res.StatusCode < 300,
+		"headers": headers,
+		"body":    parsed,
+	}
+	if retryStatus(args.RetryOn, res.StatusCode) {
+		return "", temporal.NewApplicationError("HttpRequest: "+method+" "+u.String()+" answered "+res.Status, ERROR_KIND_HTTP, response)
+	}
+	result, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+
+	return string(result), nil
+}
+
+// 429 and 5xx when retryOn isn't set, an empty list never fails
+func retryStatus(retryOn []int, status int) bool {
+	if retryOn == nil {
+		return status == http.StatusTooManyRequests || status >= 500
+	}
+	for _, s := range retryOn {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Time an HttpRequest activity gets on top of args.timeout
+const HTTP_TIMEOUT_MARGIN = 5 * time.Second
+
+// args.timeout of an HttpRequest step, 0 when it has none
+func (s *Step) httpTimeout() time.Duration {
+	if CALLS[s.Call] != "HttpRequest" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(toString(s.Args["timeout"]))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Kept for the runs started before sleep steps became durable timers (see VERSION_SLEEP_TIMER)
 func (a *ActivityType) Sleep(ctx context.Context, step *Step) error {
 	name := activity.GetInfo(ctx).ActivityType.Name
 
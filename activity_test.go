@@ -0,0 +1,180 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Server answering 503 the first `failures` times, then 200 with { n } the number of requests
+func flakyServer(failures int32) (*httptest.Server, *int32) {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		w.Header().Set("Content-Type", "application/json")
+		if n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintf(w, `{"n": %d}`, n)
+	}))
+	return srv, &count
+}
+
+func TestHttpRetriesServerErrors(t *testing.T) {
+	srv, count := flakyServer(2)
+	defer srv.Close()
+	def := `{"name":"H","steps":[
+		{"name":"post","call":"http.post","args":{"url":"` + srv.URL + `"},"retry":{"maxattempts":5,"initialinterval":1},"result":"res"},
+		{"name":"done","return":"({status: res.status, n: res.body.n})"}]}`
+	res, err := runTestWF(t, def, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != `{"n":3,"status":200}` || atomic.LoadInt32(count) != 3 {
+		t.Error(res, *count)
+	}
+}
+
+func TestHttpServerErrorCaught(t *testing.T) {
+	srv, _ := flakyServer(100)
+	defer srv.Close()
+	def := `{"name":"H","steps":[
+		{"name":"guarded","try":[
+			{"name":"post","call":"http.post","args":{"url":"` + srv.URL + `"},"retry":{"maxattempts":2,"initialinterval":1}}
+		],"except":{"errors":["HttpError"],"as":"e","steps":[{"name":"fallback","assign":{"kind":"e.kind","msg":"e.message"}}]}},
+		{"name":"done","return":"({kind: kind, has503: msg.indexOf('503') >= 0})"}]}`
+	res, err := runTestWF(t, def, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != `{"has503":true,"kind":"HttpError"}` {
+		t.Error(res)
+	}
+}
+
+// With an empty retryon every status is a result
+func TestHttpRetryOnEmpty(t *testing.T) {
+	srv, _ := flakyServer(100)
+	defer srv.Close()
+	def := `{"name":"H","steps":[
+		{"name":"post","call":"http.post","args":{"url":"` + srv.URL + `","retryon":[]},"result":"res"},
+		{"name":"done","return":"({status: res.status, ok: res.ok})"}]}`
+	res, err := runTestWF(t, def, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != `{"ok":false,"status":503}` {
+		t.Error(res)
+	}
+}
+
+func TestRetryStatus(t *testing.T) {
+	for _, c := range []struct {
+		retryOn []int
+		status  int
+		retry   bool
+	}{
+		{nil, 200, false}, {nil, 404, false}, {nil, 429, true}, {nil, 500, true}, {nil, 503, true},
+		{[]int{}, 503, false}, {[]int{409}, 409, true}, {[]int{409}, 503, false},
+	} {
+		if retryStatus(c.retryOn, c.status) != c.retry {
+			t.Error(c.retryOn, c.status)
+		}
+	}
+}
+
+// Server answering with what it received: { method, query, contentType, auth, body }
+func echoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"method":      r.Method,
+			"query":       r.URL.RawQuery,
+			"contentType": r.Header.Get("Content-Type"),
+			"auth":        r.Header.Get("Authorization"),
+			"body":        string(body),
+		})
+	}))
+}
+
+func TestHttpRequest(t *testing.T) {
+	srv := echoServer()
+	defer srv.Close()
+	for _, c := range []struct {
+		call     string
+		args     string
+		expected map[string]string
+	}{
+		{"http.post", `{"body":{"a":1}}`, map[string]string{"method": "POST", "contentType": "application/json", "body": `{"a":1}`}},
+		{"http.put", `{"body":{"a":"x y","b":2},"headers":{"content-type":"application/x-www-form-urlencoded"}}`,
+			map[string]string{"method": "PUT", "contentType": "application/x-www-form-urlencoded", "body": "a=x+y&b=2"}},
+		{"http.post", `{"body":"raw","headers":{"Content-Type":"text/plain"}}`, map[string]string{"contentType": "text/plain", "body": "raw"}},
+		{"http.request", `{"method":"patch","url":"?page=1","query":{"size":10,"page":2}}`, map[string]string{"method": "PATCH", "query": "page=2&size=10"}},
+		{"http.delete", `{"url":"?keep=1","query":{"q":"a b"}}`, map[string]string{"method": "DELETE", "query": "keep=1&q=a+b"}},
+		{"http.request", `{}`, map[string]string{"method": "GET", "auth": ""}},
+		{"http.post", `{"auth":"Token abc"}`, map[string]string{"auth": "Token abc"}},
+		{"http.post", `{"auth":"user:secret"}`, map[string]string{"auth": "Basic dXNlcjpzZWNyZXQ="}},
+		{"http.post", `{"auth":"abc"}`, map[string]string{"auth": "Bearer abc"}},
+	} {
+		step := &Step{Call: c.call}
+		json.Unmarshal([]byte(c.args), &step.Args)
+		url, _ := step.Args["url"].(string)
+		step.Args["url"] = srv.URL + url
+
+		res, err := (&ActivityType{}).HttpRequest(context.Background(), step)
+		if err != nil {
+			t.Error(c.args, err)
+			continue
+		}
+		var response struct {
+			Status int
+			Body   map[string]string
+		}
+		json.Unmarshal([]byte(res), &response)
+		for k, v := range c.expected {
+			if response.Body[k] != v {
+				t.Errorf("%s %s: %s is %q, want %q", c.call, c.args, k, response.Body[k], v)
+			}
+		}
+	}
+}
+
+func TestHttpTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1500 * time.Millisecond)
+		fmt.Fprint(w, `{"slow": true}`)
+	}))
+	defer srv.Close()
+
+	// The client gives up after args.timeout with an HttpError
+	_, err := (&ActivityType{}).HttpRequest(context.Background(), &Step{Call: "http.post", Args: map[string]interface{}{"url": srv.URL, "timeout": 1}})
+	if errorKind(err) != ERROR_KIND_HTTP {
+		t.Error(err)
+	}
+
+	// The activity gets args.timeout, longer than the 1s of the workflow
+	def := `{"name":"H","timeout":1,"retry":{"maxattempts":1},"steps":[
+		{"name":"post","call":"http.post","args":{"url":"` + srv.URL + `","timeout":3},"result":"res"},
+		{"name":"done","return":"res.body.slow"}]}`
+	res, err := runTestWF(t, def, nil)
+	if err != nil || res != "true" {
+		t.Error(res, err)
+	}
+
+	if d := (&Step{Call: "http.post", Args: map[string]interface{}{"timeout": 30.0}}).httpTimeout(); d != 30*time.Second {
+		t.Error(d)
+	}
+	if d := (&Step{Call: "http.get", Args: map[string]interface{}{"timeout": 30.0}}).httpTimeout(); d != 0 {
+		t.Error(d)
+	}
+	if d := (&Step{Call: "http.post", Args: map[string]interface{}{"timeout": "soon"}}).httpTimeout(); d != 0 {
+		t.Error(d)
+	}
+}
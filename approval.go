@@ -0,0 +1,210 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+// Signal an approval step waits on is SIGNAL_APPROVAL + APPROVAL_TOKEN_HASH(token)
+const SIGNAL_APPROVAL = "approval:"
+
+const (
+	APPROVAL_PENDING  = "pending"
+	APPROVAL_APPROVED = "approved"
+	APPROVAL_REJECTED = "rejected"
+	APPROVAL_EXPIRED  = "expired"
+)
+
+type (
+	// Wait for a human decision. Notify steps run first with the token bound to the JS variable As (default
+	// "approval"), e.g. to send the approve/reject links. The token is only bound while they run. After Timeout seconds the approval expires and the run jumps
+	// to Escalate, or just goes on with the status expired
+	ApprovalT struct {
+		Timeout  int
+		Escalate string
+		As       string
+		Notify   []*Step
+	}
+
+	// Decision sent to the workflow by POST /api/v1/approvals/:token
+	ApprovalDecision struct {
+		Approve bool
+		Comment string
+		By      string
+	}
+
+	// An approval of a run, kept in the RunState so that the server can check a token before signaling it. The
+	// state can be queried by anyone, so it only has the hash of the token
+	ApprovalRecord struct {
+		TokenHash string
+		Step      string
+		Status    string
+		Comment   string `json:",omitempty"`
+		By        string `json:",omitempty"`
+		Expires   int64  `json:",omitempty"` // unix ms, workflow time
+		Decided   int64  `json:",omitempty"`
+	}
+)
+
+// Tokens are the workflow ID and 128 random bits, so the server finds the run without a lookup table
+func newApprovalToken(ctx workflow.Context) (string, error) {
+	var random string
+	err := workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
+		bs := make([]byte, 16)
+		rand.Read(bs)
+		return hex.EncodeToString(bs)
+	}).Get(&random)
+	if err != nil {
+		return "", err
+	}
+	id := workflow.GetInfo(ctx).WorkflowExecution.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(id)) + "." + random, nil
+}
+
+func APPROVAL_TOKEN_HASH(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Anything that looks like an approval token, REDACT_APPROVAL_TOKENS checks the workflow ID part
+var approvalTokenPattern = regexp.MustCompile(`[A-Za-z0-9_-]+\.[0-9a-f]{32}`)
+
+// Replace the approval tokens of the run id in a value (args, results) so that the state and the history don't
+// give them away. The workflow ID part of a token is kept
+func REDACT_APPROVAL_TOKENS(id string, v interface{}) interface{} {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	prefix := base64.RawURLEncoding.EncodeToString([]byte(id)) + "."
+	found := false
+	bs = approvalTokenPattern.ReplaceAllFunc(bs, func(match []byte) []byte {
+		m := string(match)
+		head := strings.TrimSuffix(m[:len(m)-32], prefix)
+		if len(head) == len(m)-32 {
+			return match // Token of another run
+		}
+		found = true
+		return []byte(head + prefix + "redacted")
+	})
+	if !found {
+		return v
+	}
+	var redacted interface{}
+	json.Unmarshal(bs, &redacted)
+	return redacted
+}
+
+// Workflow ID of an approval token
+func APPROVAL_WORKFLOW_ID(token string) (string, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 1 {
+		return "", errors.New("malformed approval token")
+	}
+	id, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return "", errors.New("malformed approval token")
+	}
+	return string(id), nil
+}
+
+// Run the notify steps and wait for the decision. The result is the approval object that's also bound to JS
+func (s *Step) executeApproval(ctx workflow.Context, js JSEngine) (string, error) {
+	s.jump = ""
+	token, err := newApprovalToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	as := s.Approval.As
+	if as == "" {
+		as = "approval"
+	}
+
+	record := &ApprovalRecord{TokenHash: APPROVAL_TOKEN_HASH(token), Step: s.Name, Status: APPROVAL_PENDING}
+	signal := SIGNAL_APPROVAL + record.TokenHash
+	if s.Approval.Timeout > 0 {
+		record.Expires = nowMs(ctx) + int64(s.Approval.Timeout)*1000
+	}
+	if state, ok := ctx.Value(stateKey{}).(*RunState); ok {
+		state.Approvals = append(state.Approvals, record)
+	}
+	bindApproval(js, as, record, token)
+
+	if len(s.Approval.Notify) > 0 {
+		notify := &WF{Name: s.Name + ".notify", Steps: cloneSteps(s.Approval.Notify), Variables: make(map[string]interface{})}
+		notify.createActivitiesFromSteps()
+		err := notify.run(ctx, js)
+		for k, v := range notify.Variables {
+			s.Variables[k] = v
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	bindApproval(js, as, record, "")
+
+	var decision ApprovalDecision
+	received := false
+	selector := workflow.NewSelector(ctx)
+	selector.AddReceive(workflow.GetSignalChannel(ctx, signal), func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, &decision)
+		received = true
+	})
+	selector.AddReceive(ctx.Done(), func(c workflow.ReceiveChannel, more bool) {})
+
+	tctx, cancel := workflow.WithCancel(ctx)
+	defer cancel()
+	if s.Approval.Timeout > 0 {
+		selector.AddFuture(workflow.NewTimer(tctx, time.Duration(s.Approval.Timeout)*time.Second), func(f workflow.Future) {})
+	}
+
+	log.Println("APPROVAL: waiting ", s.Name)
+	selector.Select(ctx)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	record.Decided = nowMs(ctx)
+	if !received {
+		record.Status = APPROVAL_EXPIRED
+		s.jump = s.Approval.Escalate
+	} else if decision.Approve {
+		record.Status = APPROVAL_APPROVED
+	} else {
+		record.Status = APPROVAL_REJECTED
+	}
+	record.Comment = decision.Comment
+	record.By = decision.By
+	log.Println("APPROVAL: ", s.Name, record.Status, record.By)
+
+	return bindApproval(js, as, record, ""), nil
+}
+
+// Set the JS variable to { token, status, approved, comment, by, expires, decided } and return its JSON. token is
+// left out when it's ""
+func bindApproval(js JSEngine, as string, record *ApprovalRecord, token string) string {
+	approval := map[string]interface{}{
+		"status":   record.Status,
+		"approved": record.Status == APPROVAL_APPROVED,
+		"comment":  record.Comment,
+		"by":       record.By,
+		"expires":  record.Expires,
+		"decided":  record.Decided,
+	}
+	if token != "" {
+		approval["token"] = token
+	}
+	bs, _ := json.Marshal(approval)
+	runJS(as+" = "+string(bs)+";", js, "approval")
+	return string(bs)
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/testsuite"
+)
+
+func TestApproval(t *testing.T) {
+	InitWorkflowGlobals()
+	wf, err := NEW_WF([]byte(`{"name":"A","steps":[
+		{"name":"signoff","approval":{"timeout":3600,"as":"a","notify":[
+			{"name":"mail","call":"http.post","args":{"url":"http://mail","body":{"link":"/api/v1/approvals/${a.token}"}},"result":"sent"}
+		]},"result":"decision"},
+		{"name":"done","return":"({ approved: a.approved, by: a.by, token: typeof a.token, decision: decision })"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(WorkflowEngineMain)
+	token := ""
+	env.RegisterActivityWithOptions(func(ctx context.Context, step *Step) (string, error) {
+		link := step.Args["body"].(map[string]interface{})["link"].(string)
+		token = strings.TrimPrefix(link, "/api/v1/approvals/")
+		return `{"echo": "` + link + `"}`, nil
+	}, activity.RegisterOptions{Name: "HttpRequest"})
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(SIGNAL_APPROVAL+APPROVAL_TOKEN_HASH(token), ApprovalDecision{Approve: true, By: "boss"})
+	}, time.Minute)
+	env.ExecuteWorkflow(WorkflowEngineMain, wf)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	id, err := APPROVAL_WORKFLOW_ID(token)
+	if err != nil || id != "default-test-workflow-id" {
+		t.Fatal(token, id, err)
+	}
+	var res map[string]interface{}
+	env.GetWorkflowResult(&res)
+	decision, _ := res["decision"].(map[string]interface{})
+	if res["approved"] != true || res["by"] != "boss" || res["token"] != "undefined" || decision == nil || decision["token"] != nil {
+		t.Error(res)
+	}
+
+	// The queried state has neither the token nor the args and results with it
+	val, err := env.QueryWorkflow(QUERY_STATE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state RunState
+	val.Get(&state)
+	bs, _ := json.Marshal(state)
+	if strings.Contains(string(bs), token) || !strings.Contains(string(bs), ".redacted") {
+		t.Error(string(bs))
+	}
+	if len(state.Approvals) != 1 || state.Approvals[0].TokenHash != APPROVAL_TOKEN_HASH(token) || state.Approvals[0].Status != APPROVAL_APPROVED {
+		t.Error(state.Approvals)
+	}
+}
+
+func TestRedactApprovalTokens(t *testing.T) {
+	token := "d29yay0x.0123456789abcdef0123456789abcdef"
+	v := map[string]interface{}{"url": "/x/" + token + "?decision=approve", "n": 1}
+	redacted := REDACT_APPROVAL_TOKENS("work-1", v)
+	bs, _ := json.Marshal(redacted)
+	if string(bs) != `{"n":1,"url":"/x/d29yay0x.redacted?decision=approve"}` {
+		t.Error(string(bs))
+	}
+	// Tokens of other runs and values without one are left as is
+	if REDACT_APPROVAL_TOKENS("other", token) != token || REDACT_APPROVAL_TOKENS("work-1", "plain") != "plain" {
+		t.Error("redacted too much")
+	}
+	other := "b3RoZXI.0123456789abcdef0123456789abcdef"
+	if got := REDACT_APPROVAL_TOKENS("work-1", "a="+token+"&b="+other+"&c=x"+token); got != "a=d29yay0x.redacted&b="+other+"&c=xd29yay0x.redacted" {
+		t.Error(got)
+	}
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+type (
+	// Assignments of a step, run in the order they're written. In JSON either an object or, like Google Workflows, a
+	// list of objects with one key each, which can assign the same variable more than once:
+	// "assign": [{ "total": "0" }, { "total": "total + tax" }]
+	AssignT []AssignmentT
+
+	AssignmentT struct {
+		Name  string
+		Value interface{} // JS expression, other JSON values are assigned as they are
+	}
+)
+
+func (a *AssignT) UnmarshalJSON(bs []byte) error {
+	bs = bytes.TrimSpace(bs)
+	*a = nil
+	switch {
+	case bytes.Equal(bs, []byte("null")):
+		return nil
+	case len(bs) > 0 && bs[0] == '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(bs, &items); err != nil {
+			return err
+		}
+		for i, item := range items {
+			assignments, err := orderedObject(item)
+			if err == nil && len(assignments) != 1 {
+				err = errors.New("has " + strconv.Itoa(len(assignments)) + " keys")
+			}
+			if err != nil {
+				return errors.New("assign[" + strconv.Itoa(i) + "] must be an object with one key: " + err.Error())
+			}
+			*a = append(*a, assignments...)
+		}
+		return nil
+	}
+	assignments, err := orderedObject(bs)
+	if err != nil {
+		return errors.New("assign must be an object or a list of objects: " + err.Error())
+	}
+	*a = assignments
+	return nil
+}
+
+// Always the list form, as decoding into a map (e.g. the args of a workflow step) would lose the order of an object
+func (a AssignT) MarshalJSON() ([]byte, error) {
+	items := make([]json.RawMessage, len(a))
+	for i, assignment := range a {
+		key, _ := json.Marshal(assignment.Name)
+		value, err := json.Marshal(assignment.Value)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = json.RawMessage("{" + string(key) + ":" + string(value) + "}")
+	}
+	return json.Marshal(items)
+}
+
+// The keys and values of a JSON object in the order they're written
+func orderedObject(bs []byte) (AssignT, error) {
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, errors.New("not an object")
+	}
+	var assignments AssignT
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, AssignmentT{Name: tok.(string), Value: value})
+	}
+	return assignments, nil
+}
+
+// Assignments in the order they run. Older definitions list the keys in assignkeys, those run first and the ones
+// not listed after them
+func (s *Step) assignments() AssignT {
+	if len(s.Assignkeys) == 0 {
+		return s.Assign
+	}
+	var ordered AssignT
+	listed := make(map[string]bool)
+	for _, k := range s.Assignkeys {
+		if listed[k] {
+			continue
+		}
+		listed[k] = true
+		found := false
+		for _, a := range s.Assign {
+			if a.Name == k {
+				ordered = append(ordered, a)
+				found = true
+			}
+		}
+		if !found {
+			ordered = append(ordered, AssignmentT{Name: k}) // null, like before
+		}
+	}
+	for _, a := range s.Assign {
+		if !listed[a.Name] {
+			ordered = append(ordered, a)
+		}
+	}
+	return ordered
+}
+
+// The definition of a workflow step is decoded into the args map, which would lose the order of its assign objects.
+// Decode it as a WF first, whose assign marshals to the list form
+func (s *Step) UnmarshalJSON(bs []byte) error {
+	type plain Step
+	if err := json.Unmarshal(bs, (*plain)(s)); err != nil {
+		return err
+	}
+	if s.Args["definition"] == nil {
+		return nil
+	}
+	var raw struct {
+		Args map[string]json.RawMessage
+	}
+	var child WF
+	if json.Unmarshal(bs, &raw) != nil || json.Unmarshal(raw.Args["definition"], &child) != nil {
+		return nil // Left as it is for the validator
+	}
+	definition, _ := json.Marshal(child)
+	var generic interface{}
+	if json.Unmarshal(definition, &generic) == nil {
+		s.Args["definition"] = generic
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func assignNames(a AssignT) string {
+	var names []string
+	for _, assignment := range a {
+		names = append(names, assignment.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestAssignOrder(t *testing.T) {
+	for _, c := range []struct {
+		json     string
+		expected string
+	}{
+		{`{"z":"1","a":"z + 1","m":{"x":1}}`, "z,a,m"},
+		{`[{"total":"0"},{"total":"total + tax"},{"a":true}]`, "total,total,a"},
+		{`null`, ""},
+	} {
+		var a AssignT
+		if err := json.Unmarshal([]byte(c.json), &a); err != nil || assignNames(a) != c.expected {
+			t.Errorf("%s: got %q %v, want %q", c.json, assignNames(a), err, c.expected)
+		}
+	}
+
+	for _, bad := range []string{`[{"a":"1","b":"2"}]`, `[{}]`, `["a"]`, `"a"`} {
+		var a AssignT
+		if err := json.Unmarshal([]byte(bad), &a); err == nil {
+			t.Error(bad, a)
+		}
+	}
+}
+
+func TestAssignRoundTrip(t *testing.T) {
+	var a AssignT
+	if err := json.Unmarshal([]byte(`{"z":"1","a":{"x":[1,2]},"n":null}`), &a); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := json.Marshal(a)
+	if err != nil || string(bs) != `[{"z":"1"},{"a":{"x":[1,2]}},{"n":null}]` {
+		t.Fatal(string(bs), err)
+	}
+	var back AssignT
+	if err := json.Unmarshal(bs, &back); err != nil || assignNames(back) != "z,a,n" {
+		t.Error(back, err)
+	}
+
+	// The definition of a child workflow is in the args map, its assign objects keep their order too
+	var s Step
+	err = json.Unmarshal([]byte(`{"name":"c","call":"workflow","args":{"definition":{"steps":[
+		{"name":"a","assign":{"z":"1","a":"z + 1"}}]}}}`), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ = json.Marshal(s.Args["definition"])
+	if !strings.Contains(string(bs), `[{"z":"1"},{"a":"z + 1"}]`) {
+		t.Error(string(bs))
+	}
+}
+
+func TestAssignkeys(t *testing.T) {
+	// Listed keys first, a listed key without an assignment is null, the others follow in their order
+	var s Step
+	err := json.Unmarshal([]byte(`{"name":"a","assignkeys":["c","missing","a","c"],"assign":{"a":"1","b":"2","c":"3"}}`), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ordered := s.assignments()
+	if assignNames(ordered) != "c,missing,a,b" || ordered[1].Value != nil {
+		t.Error(ordered)
+	}
+}
+
+func TestAssignInOrder(t *testing.T) {
+	def := `{"name":"A","steps":[
+		{"name":"object","assign":{"price":"10","tax":"price * 0.2","total":"price + tax"}},
+		{"name":"list","assign":[{"total":"total * 2"},{"total":"total + 1"}]},
+		{"name":"done","return":"({ tax: tax, total: total })"}]}`
+	res, err := runTestWF(t, def, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != `{"tax":2,"total":25}` {
+		t.Error(res)
+	}
+}
@@ -2,4 +2,8 @@ go build -o bin/worker-server worker/main.go
 go build -o bin/runtime-server start/main.go
 
 GOOS=linux GOARCH=amd64 go build -o bin/worker-server-linux worker/main.go
-GOOS=linux GOARCH=amd64 go build -o bin/runtime-server-linux start/main.go
\ No newline at end of file
+GOOS=linux GOARCH=amd64 go build -o bin/runtime-server-linux start/main.go
+
+# Static (no cgo), uses the goja JS engine
+CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -o bin/worker-server-linux-static worker/main.go
+CGO_ENABLED=0 GOOS=linux GOARCH=amd64 go build -o bin/runtime-server-linux-static start/main.go
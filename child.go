@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Directory of the definitions a workflow step can start by name, <name>.json
+var DEFINITIONS_DIR = "./definitions"
+
+// The definition of a workflow step: args.definition inline or args.name loaded by the LoadDefinition activity
+func (s *Step) childDefinition(ctx workflow.Context) (WF, error) {
+	var bs []byte
+	if def, ok := s.Args["definition"]; ok && def != nil {
+		bs, _ = json.Marshal(def)
+	} else {
+		name := toString(s.Args["name"])
+		if name == "" {
+			return WF{}, temporal.NewNonRetryableApplicationError("workflow needs a definition or a name", ERROR_KIND_ARGS, nil)
+		}
+		var def string
+		err := workflow.ExecuteActivity(ctx, "LoadDefinition", name).Get(ctx, &def)
+		if err != nil {
+			return WF{}, err
+		}
+		bs = []byte(def)
+	}
+
+	child, err := NEW_WF(bs)
+	if err != nil {
+		return child, temporal.NewNonRetryableApplicationError("invalid child workflow: "+err.Error(), ERROR_KIND_ARGS, nil)
+	}
+	return child, nil
+}
+
+// Start the definition as a child workflow with args.args as its params and return its return value. With
+// args.detach the child is left running (also after this workflow ends) and the result is { workflowId, runId }
+func (s *Step) executeWorkflow(ctx workflow.Context) (string, error) {
+	child, err := s.childDefinition(ctx)
+	if err != nil {
+		return "", err
+	}
+	vars, _ := s.Args["args"].(map[string]interface{})
+	if errs := child.ApplyParams(vars); errs.HasErrors() {
+		return "", temporal.NewNonRetryableApplicationError("invalid child workflow args: "+errs.Error(), ERROR_KIND_ARGS, nil)
+	}
+
+	detach := toString(s.Args["detach"]) == "true"
+	cwo := workflow.ChildWorkflowOptions{WorkflowID: toString(s.Args["id"])} // "" => generated from this run
+	if detach {
+		cwo.ParentClosePolicy = enumspb.PARENT_CLOSE_POLICY_ABANDON
+	}
+	future := workflow.ExecuteChildWorkflow(workflow.WithChildOptions(ctx, cwo), WorkflowEngineMain, child)
+
+	var execution workflow.Execution
+	err = future.GetChildWorkflowExecution().Get(ctx, &execution)
+	if err != nil {
+		return "", err
+	}
+	log.Println("CHILD: ", s.Name, child.Name, execution.ID, execution.RunID)
+
+	if detach {
+		bs, _ := json.Marshal(map[string]string{"workflowId": execution.ID, "runId": execution.RunID})
+		return string(bs), nil
+	}
+
+	var result interface{}
+	err = future.Get(ctx, &result)
+	if err != nil {
+		return "", err
+	}
+	bs, err := json.Marshal(result) // The child returns JSON values, a string stays a string
+	return string(bs), err
+}
+
+// Read a definition from DEFINITIONS_DIR, <name>.json or a .yaml/.yml converted to JSON. An activity, as workflow
+// code can't do IO
+func (a *ActivityType) LoadDefinition(ctx context.Context, name string) (string, error) {
+	if name != filepath.Base(name) {
+		return "", temporal.NewNonRetryableApplicationError("invalid definition name "+name, ERROR_KIND_ARGS, nil)
+	}
+	for _, ext := range []string{".json", ".yaml", ".yml"} {
+		bs, err := ioutil.ReadFile(filepath.Join(DEFINITIONS_DIR, name+ext))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil || ext == ".json" {
+			return string(bs), err
+		}
+		bs, _, err = YAML_TO_JSON(bs)
+		if err != nil {
+			return "", temporal.NewNonRetryableApplicationError(name+ext+": "+err.Error(), ERROR_KIND_ARGS, nil)
+		}
+		return string(bs), nil
+	}
+	return "", temporal.NewNonRetryableApplicationError("no definition "+name, ERROR_KIND_ARGS, nil)
+}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testChild = `{"name":"Child","params":[{"name":"n","type":"integer"}],"steps":[
+	{"name":"ping","call":"http.post","args":{"url":"http://x","body":{"n":"${n}"}},"result":"res"},
+	{"name":"done","return":"({ doubled: n * 2, status: res.status })"}]}`
+
+var childMocks = testMocks{"http.post": func(step *Step) (string, error) { return `{"status": 201}`, nil }}
+
+func TestChildInline(t *testing.T) {
+	def := `{"name":"Parent","steps":[
+		{"name":"child","call":"workflow","args":{"definition":` + testChild + `,"args":{"n":"${1 + 20}"}},"result":"c"},
+		{"name":"done","return":"c"}]}`
+	res, err := runTestWF(t, def, childMocks)
+	if err != nil || res != `{"doubled":42,"status":201}` {
+		t.Error(res, err)
+	}
+}
+
+func TestChildByName(t *testing.T) {
+	dir := DEFINITIONS_DIR
+	DEFINITIONS_DIR = t.TempDir()
+	defer func() { DEFINITIONS_DIR = dir }()
+	yaml := "name: Child\nparams:\n  - name: n\n    type: integer\nsteps:\n  - name: done\n    return: n + 1\n"
+	if err := ioutil.WriteFile(filepath.Join(DEFINITIONS_DIR, "child.yaml"), []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	def := `{"name":"Parent","steps":[
+		{"name":"child","call":"workflow","args":{"name":"child","args":{"n":1}},"result":"c"},
+		{"name":"done","return":"c"}]}`
+	res, err := runTestWF(t, def, nil)
+	if err != nil || res != `2` {
+		t.Error(res, err)
+	}
+
+	// Unknown names and paths fail the step
+	for _, name := range []string{"missing", "../child"} {
+		def := `{"name":"Parent","steps":[{"name":"child","call":"workflow","args":{"name":"` + name + `"}}]}`
+		if _, err := runTestWF(t, def, nil); err == nil || !strings.Contains(err.Error(), "ArgsError") {
+			t.Error(name, err)
+		}
+	}
+}
+
+// The args of the child are checked against its params before it starts
+func TestChildInvalidArgs(t *testing.T) {
+	def := `{"name":"Parent","steps":[
+		{"name":"child","call":"workflow","args":{"definition":` + testChild + `,"args":{"n":"many"}}}]}`
+	_, err := runTestWF(t, def, testMocks{
+		"http.post": func(step *Step) (string, error) { t.Error("the child ran"); return "", nil },
+	})
+	if err == nil || !strings.Contains(err.Error(), "invalid child workflow args") || !strings.Contains(err.Error(), "params.n") {
+		t.Error(err)
+	}
+}
+
+// A detached child is left running, the step returns its IDs right away
+func TestChildDetach(t *testing.T) {
+	def := `{"name":"Parent","steps":[
+		{"name":"child","call":"workflow","args":{"id":"child-1","detach":true,"definition":{"name":"Slow","steps":[
+			{"name":"wait","call":"sleep","args":{"seconds":3600}},
+			{"name":"late","call":"http.post","args":{"url":"http://x"}}]}},"result":"c"},
+		{"name":"done","return":"c.workflowId"}]}`
+	res, err := runTestWF(t, def, testMocks{
+		"http.post": func(step *Step) (string, error) { t.Error("the parent waited for the child"); return "", nil },
+	})
+	if err != nil || res != `"child-1"` {
+		t.Error(res, err)
+	}
+}
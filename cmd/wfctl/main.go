@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pborman/uuid"
+	enumspb "go.temporal.io/api/enums/v1"
+	filterpb "go.temporal.io/api/filter/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+
+	"workflow_engine/app"
+	"workflow_engine/app/local"
+)
+
+const USAGE = `wfctl [-v] <command> [flags] [args]
+
+  validate file.json...        check definitions (.json, .yaml or .yml), warnings included
+  run [flags] file.json        start a definition, --local runs it in process without Temporal
+      --input vars.json          params of the run
+      --wait                     wait for the result (Temporal runs)
+      --timeout 30s              how long --wait waits
+      --id id                    workflow ID (Temporal runs)
+      --local                    run in process, sleeps fire right away
+      --mocks mocks.json         activity results by step name or call, { "$error": "..." } fails the step (--local)
+      --steps                    print the steps of the run too (--local)
+  status <id>                  status, start/close time and the steps currently running
+  result [--wait 30s] <id>     return value of a run
+  cancel <id>                  cancel a run, its finally steps still run
+  list [--closed]              runs that are open (or closed)
+  graph [--format dot] file.json
+                               control flow as Graphviz dot or a mermaid flowchart
+
+Temporal is at HOSTPORT (env or .env), default localhost:7233. Output is JSON on stdout, -v logs to stderr
+`
+
+// Exit codes
+const (
+	EXIT_FAIL  = 1
+	EXIT_USAGE = 2
+)
+
+var COMMANDS = map[string]func(args []string) error{
+	"validate": validateCmd,
+	"run":      runCmd,
+	"status":   statusCmd,
+	"result":   resultCmd,
+	"cancel":   cancelCmd,
+	"list":     listCmd,
+	"graph":    graphCmd,
+}
+
+var errUsage = errors.New("usage")
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, USAGE) }
+	verbose := flag.Bool("v", false, "log to stderr")
+	flag.Parse()
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+	godotenv.Load()
+
+	cmd, ok := COMMANDS[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(EXIT_USAGE)
+	}
+	err := cmd(flag.Args()[1:])
+	if err == errUsage {
+		flag.Usage()
+		os.Exit(EXIT_USAGE)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "wfctl "+flag.Arg(0)+": "+err.Error())
+		os.Exit(EXIT_FAIL)
+	}
+}
+
+// Flags may come after the arguments: run file.json --input vars.json
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		if fs.NArg() == 0 {
+			return rest, nil
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+func printJSON(v interface{}) error {
+	bs, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bs))
+	return nil
+}
+
+// Same client options as the worker and the runtime server
+func newClient() (client.Client, error) {
+	option := app.CLIENT_OPTIONS()
+	option.Logger = logger{}
+	return client.NewClient(option)
+}
+
+// JSON or YAML by the extension
+func readWF(file string) (app.WF, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return app.WF{}, err
+	}
+	if app.IsYAMLFile(file) {
+		return app.NEW_WF_YAML(bs)
+	}
+	return app.NEW_WF(bs)
+}
+
+// Inputs and mocks can be YAML too
+func readJSON(file string, v interface{}) error {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if app.IsYAMLFile(file) {
+		bs, _, err = app.YAML_TO_JSON(bs)
+		if err != nil {
+			return errors.New(file + ": " + err.Error())
+		}
+	}
+	if err := json.Unmarshal(bs, v); err != nil {
+		return errors.New(file + ": " + err.Error())
+	}
+	return nil
+}
+
+func validateCmd(args []string) error {
+	files, err := parseArgs(newFlagSet("validate"), args)
+	if err != nil || len(files) == 0 {
+		return errUsage
+	}
+	invalid := 0
+	for _, file := range files {
+		bs, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		errs := app.VALIDATE_WF(bs)
+		if app.IsYAMLFile(file) {
+			errs = app.VALIDATE_WF_YAML(bs)
+		}
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, file+": "+e.Error())
+		}
+		if errs.HasErrors() {
+			invalid++
+			continue
+		}
+		fmt.Println(file + ": ok")
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d of %d definitions are invalid", invalid, len(files))
+	}
+	return nil
+}
+
+func runCmd(args []string) error {
+	fs := newFlagSet("run")
+	input := fs.String("input", "", "")
+	wait := fs.Bool("wait", false, "")
+	timeout := fs.Duration("timeout", 30*time.Second, "")
+	id := fs.String("id", "", "")
+	inProcess := fs.Bool("local", false, "")
+	mocks := fs.String("mocks", "", "")
+	steps := fs.Bool("steps", false, "")
+	files, err := parseArgs(fs, args)
+	if err != nil || len(files) != 1 {
+		return errUsage
+	}
+
+	wf, err := readWF(files[0])
+	if err != nil {
+		return err
+	}
+	params := make(map[string]interface{})
+	if *input != "" {
+		if err := readJSON(*input, &params); err != nil {
+			return err
+		}
+	}
+	if errs := wf.ApplyParams(params); errs.HasErrors() {
+		return errs
+	}
+
+	if *inProcess {
+		opts := local.Options{Logger: logger{}}
+		if *mocks != "" {
+			if err := readJSON(*mocks, &opts.Mocks); err != nil {
+				return err
+			}
+			for k, v := range opts.Mocks {
+				if m, ok := v.(map[string]interface{}); ok && len(m) == 1 && m["$error"] != nil {
+					opts.Mocks[k] = errors.New(fmt.Sprint(m["$error"]))
+				}
+			}
+		}
+		app.InitWorkflowGlobals()
+		res, err := local.Run(wf, opts)
+		if err != nil {
+			return err
+		}
+		if *steps {
+			// No state when the run failed before it could be queried
+			records := []app.StepRecord{}
+			if res.State != nil {
+				records = res.State.Steps
+			}
+			return printJSON(map[string]interface{}{"result": res.Result, "steps": records})
+		}
+		return printJSON(res.Result)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	options := client.StartWorkflowOptions{
+		ID:        *id,
+		TaskQueue: app.WorkflowEngineTaskQueue,
+	}
+	if options.ID == "" {
+		options.ID = "workflow-" + uuid.New()
+	}
+	we, err := c.ExecuteWorkflow(context.Background(), options, app.WorkflowEngineMain, wf)
+	if err != nil {
+		return err
+	}
+	out := map[string]interface{}{"workflowId": we.GetID(), "runId": we.GetRunID()}
+	if *wait {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		var result interface{}
+		if err := we.Get(ctx, &result); err != nil {
+			printJSON(out)
+			if ctx.Err() != nil {
+				return errors.New("still running after " + timeout.String())
+			}
+			return err
+		}
+		out["result"] = result
+	}
+	return printJSON(out)
+}
+
+func statusCmd(args []string) error {
+	ids, err := parseArgs(newFlagSet("status"), args)
+	if err != nil || len(ids) != 1 {
+		return errUsage
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	status, err := app.WORKFLOW_STATUS(context.Background(), c, ids[0], "")
+	if err != nil {
+		return err
+	}
+	return printJSON(status)
+}
+
+func resultCmd(args []string) error {
+	fs := newFlagSet("result")
+	wait := fs.Duration("wait", 0, "")
+	ids, err := parseArgs(fs, args)
+	if err != nil || len(ids) != 1 {
+		return errUsage
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	desc, err := c.DescribeWorkflowExecution(context.Background(), ids[0], "")
+	if err != nil {
+		return err
+	}
+	running := desc.GetWorkflowExecutionInfo().GetStatus() == enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING
+	if running && *wait == 0 {
+		return errors.New(ids[0] + " is still running")
+	}
+	ctx := context.Background()
+	if running {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *wait)
+		defer cancel()
+	}
+	var result interface{}
+	err = c.GetWorkflow(context.Background(), ids[0], "").Get(ctx, &result)
+	if err != nil && ctx.Err() != nil {
+		return errors.New(ids[0] + " is still running after " + wait.String())
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(result)
+}
+
+func cancelCmd(args []string) error {
+	ids, err := parseArgs(newFlagSet("cancel"), args)
+	if err != nil || len(ids) != 1 {
+		return errUsage
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.CancelWorkflow(context.Background(), ids[0], "")
+}
+
+func listCmd(args []string) error {
+	fs := newFlagSet("list")
+	closed := fs.Bool("closed", false, "")
+	rest, err := parseArgs(fs, args)
+	if err != nil || len(rest) != 0 {
+		return errUsage
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	typeFilter := &filterpb.WorkflowTypeFilter{Name: "WorkflowEngineMain"}
+	var executions []*workflowpb.WorkflowExecutionInfo
+	if *closed {
+		res, err := c.ListClosedWorkflow(context.Background(), &workflowservice.ListClosedWorkflowExecutionsRequest{
+			Namespace: client.DefaultNamespace,
+			Filters:   &workflowservice.ListClosedWorkflowExecutionsRequest_TypeFilter{TypeFilter: typeFilter},
+		})
+		if err != nil {
+			return err
+		}
+		executions = res.GetExecutions()
+	} else {
+		res, err := c.ListOpenWorkflow(context.Background(), &workflowservice.ListOpenWorkflowExecutionsRequest{
+			Namespace: client.DefaultNamespace,
+			Filters:   &workflowservice.ListOpenWorkflowExecutionsRequest_TypeFilter{TypeFilter: typeFilter},
+		})
+		if err != nil {
+			return err
+		}
+		executions = res.GetExecutions()
+	}
+
+	runs := []map[string]interface{}{}
+	for _, info := range executions {
+		runs = append(runs, map[string]interface{}{
+			"workflowId":     info.GetExecution().GetWorkflowId(),
+			"runId":          info.GetExecution().GetRunId(),
+			"workflowStatus": info.GetStatus().String(),
+			"startTime":      info.GetStartTime(),
+			"closeTime":      info.GetCloseTime(),
+		})
+	}
+	return printJSON(runs)
+}
+
+// Control flow as Graphviz DOT or a Mermaid flowchart, e.g. wfctl graph file.json | dot -Tsvg > file.svg
+func graphCmd(args []string) error {
+	fs := newFlagSet("graph")
+	format := fs.String("format", "dot", "")
+	files, err := parseArgs(fs, args)
+	if err != nil || len(files) != 1 {
+		return errUsage
+	}
+	wf, err := readWF(files[0])
+	if err != nil {
+		return err
+	}
+	out, err := wf.Graph().Format(*format)
+	if err != nil {
+		return err
+	}
+	fmt.Print(out)
+	return nil
+}
+
+// Temporal logger writing to the standard logger, which -v turns on
+type logger struct{}
+
+func (logger) Debug(msg string, keyvals ...interface{}) {
+	log.Println(append([]interface{}{"DEBUG", msg}, keyvals...)...)
+}
+
+func (logger) Info(msg string, keyvals ...interface{}) {
+	log.Println(append([]interface{}{"INFO", msg}, keyvals...)...)
+}
+
+func (logger) Warn(msg string, keyvals ...interface{}) {
+	log.Println(append([]interface{}{"WARN", msg}, keyvals...)...)
+}
+
+func (logger) Error(msg string, keyvals ...interface{}) {
+	log.Println(append([]interface{}{"ERROR", msg}, keyvals...)...)
+}
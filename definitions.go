@@ -0,0 +1,208 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ERR_DEFINITION_NOT_FOUND = errors.New("definition not found")
+
+type (
+	// A version of a named definition. Versions start at 1 and are never changed, only deprecated
+	DefinitionT struct {
+		Name       string          `json:"name"`
+		Version    int             `json:"version"`
+		Definition json.RawMessage `json:"definition,omitempty"`
+		Created    time.Time       `json:"created"`
+		Deprecated bool            `json:"deprecated"`
+	}
+
+	// Storage of the definitions registry. Version 0 means the latest version that isn't deprecated
+	DefinitionStore interface {
+		Put(name string, definition []byte) (DefinitionT, error) // Adds the next version
+		Get(name string, version int) (DefinitionT, error)
+		Versions(name string) ([]DefinitionT, error)
+		List() ([]DefinitionT, error) // Latest version of every name, without the definition
+		Deprecate(name string, version int) (DefinitionT, error)
+		Close() error
+	}
+)
+
+// Definition store backends by name, DEFINITION_STORE picks one. path is a file or DSN, backend specific
+var DEFINITION_STORES = map[string]func(path string) (DefinitionStore, error){
+	"bolt": NEW_BOLT_STORE,
+	"memory": func(path string) (DefinitionStore, error) {
+		return NEW_MEMORY_STORE(), nil
+	},
+}
+
+func NEW_DEFINITION_STORE(name string, path string) (DefinitionStore, error) {
+	if name == "" {
+		name = "bolt"
+	}
+	newStore, ok := DEFINITION_STORES[name]
+	if !ok {
+		return nil, errors.New("unknown definition store " + strconv.Quote(name))
+	}
+	return newStore(path)
+}
+
+// Latest version that isn't deprecated, or the version asked for
+func latestDefinition(versions []DefinitionT, version int) (DefinitionT, error) {
+	for i := len(versions) - 1; i >= 0; i-- {
+		d := versions[i]
+		if (version == 0 && !d.Deprecated) || d.Version == version {
+			return d, nil
+		}
+	}
+	return DefinitionT{}, ERR_DEFINITION_NOT_FOUND
+}
+
+// How deep workflow steps can name other definitions, a definition calling itself never ends
+const MAX_CHILD_DEPTH = 10
+
+// Inline the stored definitions named by workflow steps, so that a run pins the versions it started with. Names that
+// aren't in the store are left to the LoadDefinition activity
+func (wf *WF) ResolveChildren(store DefinitionStore) error {
+	return resolveChildren(store, wf.allSteps(), 0)
+}
+
+func resolveChildren(store DefinitionStore, steps []*Step, depth int) error {
+	for _, s := range steps {
+		if s.Call != "workflow" || s.Args["definition"] != nil || toString(s.Args["name"]) == "" {
+			continue
+		}
+		if depth >= MAX_CHILD_DEPTH {
+			return errors.New("workflow steps nested more than " + strconv.Itoa(MAX_CHILD_DEPTH) + " deep at " + s.Name)
+		}
+		name := toString(s.Args["name"])
+		version, _ := strconv.Atoi(toString(s.Args["version"]))
+		d, err := store.Get(name, version)
+		if err == ERR_DEFINITION_NOT_FOUND {
+			log.Println("No stored definition ", name, version, ", loaded by the worker")
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var child WF
+		err = json.Unmarshal(d.Definition, &child)
+		if err != nil {
+			return err
+		}
+		err = resolveChildren(store, child.allSteps(), depth+1)
+		if err != nil {
+			return err
+		}
+		child.Version = d.Version
+		bs, _ := json.Marshal(child)
+		var definition interface{}
+		json.Unmarshal(bs, &definition)
+		s.Args["definition"] = definition
+		s.Args["version"] = d.Version
+	}
+	return nil
+}
+
+// Every step of the definition, nested ones included
+func (wf *WF) allSteps() []*Step {
+	var all []*Step
+	var walk func(steps []*Step)
+	walk = func(steps []*Step) {
+		for _, s := range steps {
+			if s == nil {
+				continue
+			}
+			all = append(all, s)
+			walk(s.Children)
+			walk(s.Try)
+			if s.Except != nil {
+				walk(s.Except.Steps)
+			}
+			if s.Parallel != nil {
+				for _, b := range s.Parallel.Branches {
+					walk(b.Steps)
+				}
+			}
+			if s.Approval != nil {
+				walk(s.Approval.Notify)
+			}
+		}
+	}
+	walk(wf.Steps)
+	walk(wf.Finally)
+	return all
+}
+
+// In memory store, for tests and local runs
+type memoryStore struct {
+	mu          sync.Mutex
+	definitions map[string][]DefinitionT
+}
+
+func NEW_MEMORY_STORE() DefinitionStore {
+	return &memoryStore{definitions: make(map[string][]DefinitionT)}
+}
+
+func (m *memoryStore) Put(name string, definition []byte) (DefinitionT, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := DefinitionT{Name: name, Version: len(m.definitions[name]) + 1, Definition: definition, Created: time.Now()}
+	m.definitions[name] = append(m.definitions[name], d)
+	return d, nil
+}
+
+func (m *memoryStore) Get(name string, version int) (DefinitionT, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return latestDefinition(m.definitions[name], version)
+}
+
+func (m *memoryStore) Versions(name string) ([]DefinitionT, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions, ok := m.definitions[name]
+	if !ok {
+		return nil, ERR_DEFINITION_NOT_FOUND
+	}
+	return append([]DefinitionT{}, versions...), nil
+}
+
+func (m *memoryStore) List() ([]DefinitionT, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.definitions))
+	for name := range m.definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := []DefinitionT{}
+	for _, name := range names {
+		versions := m.definitions[name]
+		d := versions[len(versions)-1]
+		d.Definition = nil
+		list = append(list, d)
+	}
+	return list, nil
+}
+
+func (m *memoryStore) Deprecate(name string, version int) (DefinitionT, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions := m.definitions[name]
+	if version < 1 || version > len(versions) {
+		return DefinitionT{}, ERR_DEFINITION_NOT_FOUND
+	}
+	versions[version-1].Deprecated = true
+	return versions[version-1], nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testStores(t *testing.T) map[string]DefinitionStore {
+	t.Helper()
+	bolt, err := NEW_BOLT_STORE(filepath.Join(t.TempDir(), "definitions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]DefinitionStore{"memory": NEW_MEMORY_STORE(), "bolt": bolt}
+}
+
+func TestDefinitionStores(t *testing.T) {
+	for name, store := range testStores(t) {
+		for i, def := range []string{`{"v":1}`, `{"v":2}`, `{"v":3}`} {
+			d, err := store.Put("orders", []byte(def))
+			if err != nil || d.Version != i+1 || d.Name != "orders" {
+				t.Fatal(name, d, err)
+			}
+		}
+		store.Put("billing", []byte(`{"v":1}`))
+
+		if d, err := store.Get("orders", 0); err != nil || d.Version != 3 || string(d.Definition) != `{"v":3}` {
+			t.Error(name, "latest", d, err)
+		}
+		if d, err := store.Get("orders", 2); err != nil || d.Version != 2 || string(d.Definition) != `{"v":2}` {
+			t.Error(name, "pinned", d, err)
+		}
+		if _, err := store.Get("orders", 7); err != ERR_DEFINITION_NOT_FOUND {
+			t.Error(name, "unknown version", err)
+		}
+		if _, err := store.Get("missing", 0); err != ERR_DEFINITION_NOT_FOUND {
+			t.Error(name, "unknown name", err)
+		}
+
+		// Deprecated versions can still be pinned, the latest is the one before
+		if d, err := store.Deprecate("orders", 3); err != nil || !d.Deprecated {
+			t.Error(name, "deprecate", d, err)
+		}
+		if _, err := store.Deprecate("orders", 9); err != ERR_DEFINITION_NOT_FOUND {
+			t.Error(name, "deprecate unknown", err)
+		}
+		if d, _ := store.Get("orders", 0); d.Version != 2 {
+			t.Error(name, "latest after deprecate", d)
+		}
+		if d, _ := store.Get("orders", 3); d.Version != 3 || !d.Deprecated {
+			t.Error(name, "pinned deprecated", d)
+		}
+
+		versions, err := store.Versions("orders")
+		if err != nil || len(versions) != 3 || versions[0].Version != 1 || !versions[2].Deprecated {
+			t.Error(name, "versions", versions, err)
+		}
+		if _, err := store.Versions("missing"); err != ERR_DEFINITION_NOT_FOUND {
+			t.Error(name, "versions of unknown", err)
+		}
+
+		list, err := store.List()
+		if err != nil || len(list) != 2 || list[0].Name != "billing" || list[1].Name != "orders" || list[1].Version != 3 || list[1].Definition != nil {
+			t.Error(name, "list", list, err)
+		}
+		store.Close()
+	}
+}
+
+func TestLatestDefinition(t *testing.T) {
+	versions := []DefinitionT{{Version: 1}, {Version: 2}, {Version: 3, Deprecated: true}}
+	if d, err := latestDefinition(versions, 0); err != nil || d.Version != 2 {
+		t.Error(d, err)
+	}
+	versions[0].Deprecated, versions[1].Deprecated = true, true
+	if _, err := latestDefinition(versions, 0); err != ERR_DEFINITION_NOT_FOUND {
+		t.Error(err)
+	}
+	if d, err := latestDefinition(versions, 1); err != nil || d.Version != 1 {
+		t.Error(d, err)
+	}
+}
+
+func TestResolveChildren(t *testing.T) {
+	store := NEW_MEMORY_STORE()
+	store.Put("child", []byte(`{"name":"Child","steps":[{"name":"done","return":"1"}]}`))
+	store.Put("child", []byte(`{"name":"Child","steps":[{"name":"grandchild","call":"workflow","args":{"name":"child","version":1}},{"name":"done","return":"2"}]}`))
+
+	wf, err := NEW_WF([]byte(`{"name":"Parent","steps":[
+		{"name":"latest","call":"workflow","args":{"name":"child"}},
+		{"name":"pinned","call":"workflow","args":{"name":"child","version":1}},
+		{"name":"unknown","call":"workflow","args":{"name":"elsewhere"}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wf.ResolveChildren(store); err != nil {
+		t.Fatal(err)
+	}
+	latest, pinned, unknown := wf.Steps[0].Args, wf.Steps[1].Args, wf.Steps[2].Args
+	bs, _ := json.Marshal(latest["definition"])
+	if latest["version"] != 2 || !strings.Contains(string(bs), `"Version":2`) || !strings.Contains(string(bs), `"Version":1`) {
+		t.Error("latest", latest["version"], string(bs))
+	}
+	bs, _ = json.Marshal(pinned["definition"])
+	if pinned["version"] != 1 || !strings.Contains(string(bs), `"Version":1`) || strings.Contains(string(bs), "grandchild") {
+		t.Error("pinned", pinned["version"], string(bs))
+	}
+	// Left to the LoadDefinition activity
+	if unknown["definition"] != nil {
+		t.Error("unknown", unknown)
+	}
+
+	// A definition starting itself never ends
+	store.Put("loop", []byte(`{"name":"Loop","steps":[{"name":"again","call":"workflow","args":{"name":"loop"}}]}`))
+	wf, _ = NEW_WF([]byte(`{"name":"Parent","steps":[{"name":"start","call":"workflow","args":{"name":"loop"}}]}`))
+	if err := wf.ResolveChildren(store); err == nil || !strings.Contains(err.Error(), "nested more than 10 deep") {
+		t.Error(err)
+	}
+}
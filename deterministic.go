@@ -0,0 +1,151 @@
+package app
+
+import (
+	"log"
+	"math/rand"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Replaces Date and Math.random with versions backed by __now/__random. A replay of the workflow re-runs every JS
+// expression from the start, so everything the JS can observe must come from the workflow history
+const DETERMINISTIC_JS = `
+(function (NativeDate, bind, slice) {
+	function WorkflowDate() {
+		if (!(this instanceof WorkflowDate)) {
+			return new NativeDate(__now()).toString();
+		}
+		if (arguments.length === 0) {
+			return new NativeDate(__now());
+		}
+		var args = [null].concat(slice.call(arguments));
+		return new (bind.apply(NativeDate, args))();
+	}
+	WorkflowDate.prototype = NativeDate.prototype;
+	WorkflowDate.now = function () { return __now(); };
+	WorkflowDate.parse = NativeDate.parse;
+	WorkflowDate.UTC = NativeDate.UTC;
+	Date = WorkflowDate;
+	Math.random = function () { return __random(); };
+})(Date, Function.prototype.bind, Array.prototype.slice);
+`
+
+// JS engine of a run. Remembers the errors of the expressions that didn't stop it (assign, args, result, match,
+// return) and the limit an evaluation hit
+type workflowJS struct {
+	JSEngine
+	run *jsRun // Shared with the engines of concurrent for iterations
+}
+
+type jsRun struct {
+	errors []string
+	limit  error // ERR_JS_TIMEOUT or ERR_JS_HEAP, until the step is failed with it
+}
+
+// New JS engine for a workflow run: deterministic globals, z.js and only the allowed globals
+func newWorkflowJS(ctx workflow.Context) (JSEngine, error) {
+	js, err := NEW_JS_ENGINE(JS_ENGINE, JSHost{
+		// Time of the current workflow task, the same on every replay
+		Now: func() float64 {
+			return float64(workflow.Now(ctx).UnixNano() / int64(time.Millisecond))
+		},
+		// Recorded in the history on the first run, read back from it on replay
+		Random: func() float64 {
+			var r float64
+			workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
+				return rand.Float64()
+			}).Get(&r)
+			return r
+		},
+	}, JS_LIMITS)
+	if err != nil {
+		return nil, err
+	}
+
+	err = js.Load(DETERMINISTIC_JS, "deterministic.js")
+	if err != nil {
+		js.Close()
+		return nil, err
+	}
+	// z.js evaluates the default values of match conditions, it gets eval as restrictGlobals removes it
+	err = js.Load("var z = (function (eval) {\n"+Z_SRC+"\nreturn z;\n})(eval);", "z.js")
+	if err != nil {
+		log.Println("COULDN'T LOAD z.js: ", err) // match won't work, everything else will
+	}
+
+	err = restrictGlobals(js)
+	if err != nil {
+		js.Close()
+		return nil, err
+	}
+	return &workflowJS{JSEngine: js, run: &jsRun{}}, nil
+}
+
+func (w *workflowJS) Eval(code string, ref string) (string, error) {
+	val, err := w.JSEngine.Eval(code, ref)
+	return val, w.checkLimit(err)
+}
+
+func (w *workflowJS) Assign(name string, code string, ref string) (string, error) {
+	val, err := w.JSEngine.Assign(name, code, ref)
+	return val, w.checkLimit(err)
+}
+
+func (w *workflowJS) Template(template string, ref string) (string, error) {
+	val, err := w.JSEngine.Template(template, ref)
+	return val, w.checkLimit(err)
+}
+
+func (w *workflowJS) Get(name string) (string, error) {
+	val, err := w.JSEngine.Get(name)
+	return val, w.checkLimit(err)
+}
+
+func (w *workflowJS) Set(name string, json string) error {
+	return w.checkLimit(w.JSEngine.Set(name, json))
+}
+
+func (w *workflowJS) checkLimit(err error) error {
+	if (err == ERR_JS_TIMEOUT || err == ERR_JS_HEAP) && w.run.limit == nil {
+		w.run.limit = err
+	}
+	return err
+}
+
+// The limit hit by an evaluation since the last call, as the error failing the step. Whether an evaluation hits a
+// limit depends on the worker, so a replay on another one may not: the error can't be caught by except, the run fails
+func takeJSLimit(js JSEngine) error {
+	w, ok := js.(*workflowJS)
+	if !ok || w.run.limit == nil {
+		return nil
+	}
+	err := w.run.limit
+	w.run.limit = nil
+	return temporal.NewNonRetryableApplicationError(err.Error(), ERROR_KIND_JS_LIMIT, nil)
+}
+
+// Remember the error of an expression, the run fails with a JSError once its steps are done
+func recordJSError(js JSEngine, ref string, err error) {
+	log.Println("JS ERROR: ", ref, err)
+	if w, ok := js.(*workflowJS); ok {
+		w.run.errors = append(w.run.errors, ref+": "+err.Error())
+	}
+}
+
+func jsErrors(js JSEngine) []string {
+	if w, ok := js.(*workflowJS); ok {
+		return w.run.errors
+	}
+	return nil
+}
+
+// Errors and limits hit in to are reported with the ones of from
+func shareJSRun(from JSEngine, to JSEngine) {
+	f, ok := from.(*workflowJS)
+	t, ok2 := to.(*workflowJS)
+	if ok && ok2 {
+		t.run = f.run
+	}
+}
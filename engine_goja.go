@@ -0,0 +1,71 @@
+package app
+
+import (
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// Pure Go engine, works without cgo (static and cross compiled builds)
+type gojaEngine struct {
+	vm     *goja.Runtime
+	limits JSLimits
+}
+
+func newGojaEngine(host JSHost, limits JSLimits) (JSEngine, error) {
+	vm := goja.New()
+	vm.Set("__now", host.Now)
+	vm.Set("__random", host.Random)
+	return &gojaEngine{vm: vm, limits: limits}, nil
+}
+
+// No heap limit, goja allocates on the Go heap
+func (e *gojaEngine) Eval(code string, ref string) (string, error) {
+	if e.limits.Timeout > 0 {
+		timer := time.AfterFunc(e.limits.Timeout, func() {
+			e.vm.Interrupt(ERR_JS_TIMEOUT)
+		})
+		defer func() {
+			timer.Stop()
+			e.vm.ClearInterrupt()
+		}()
+	}
+
+	val, err := e.vm.RunScript(ref, code)
+	if _, ok := err.(*goja.InterruptedError); ok {
+		return "", ERR_JS_TIMEOUT
+	}
+	if err != nil {
+		return "", err
+	}
+	if val == nil {
+		return "undefined", nil
+	}
+	return checkOutput(e.limits, val.String())
+}
+
+func (e *gojaEngine) Assign(name string, code string, ref string) (string, error) {
+	return e.Eval(name+" = "+code, ref)
+}
+
+// The pinned goja has no template literals
+func (e *gojaEngine) Template(template string, ref string) (string, error) {
+	return interpolate(e, template, ref)
+}
+
+func (e *gojaEngine) Get(name string) (string, error) {
+	return e.Eval("JSON.stringify("+name+")", "get.js")
+}
+
+func (e *gojaEngine) Set(name string, json string) error {
+	_, err := e.Eval(name+" = "+json+";", "set.js")
+	return err
+}
+
+func (e *gojaEngine) Load(src string, ref string) error {
+	_, err := e.Eval(src, ref)
+	return err
+}
+
+func (e *gojaEngine) Close() {
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"time"
+
+	"github.com/robertkrimen/otto"
+)
+
+// ES5 only: no template literals (${} are interpolated one by one) and no let/const, so z.js can't be loaded
+type ottoEngine struct {
+	vm     *otto.Otto
+	limits JSLimits
+}
+
+func newOttoEngine(host JSHost, limits JSLimits) (JSEngine, error) {
+	vm := otto.New()
+	hostFunc := func(f func() float64) func(call otto.FunctionCall) otto.Value {
+		return func(call otto.FunctionCall) otto.Value {
+			val, _ := call.Otto.ToValue(f())
+			return val
+		}
+	}
+	vm.Set("__now", hostFunc(host.Now))
+	vm.Set("__random", hostFunc(host.Random))
+	vm.Interrupt = make(chan func(), 1)
+	return &ottoEngine{vm: vm, limits: limits}, nil
+}
+
+// Otto runs the interrupt func between statements, it panics to stop the script. No heap limit
+func (e *ottoEngine) Eval(code string, ref string) (result string, err error) {
+	if e.limits.Timeout > 0 {
+		done := make(chan struct{})
+		timer := time.AfterFunc(e.limits.Timeout, func() {
+			select {
+			case e.vm.Interrupt <- func() {
+				select {
+				case <-done: // fired after the script was done
+				default:
+					panic(ERR_JS_TIMEOUT)
+				}
+			}:
+			default:
+			}
+		})
+		defer func() {
+			timer.Stop()
+			close(done)
+			if r := recover(); r != nil {
+				if r != ERR_JS_TIMEOUT {
+					panic(r)
+				}
+				result, err = "", ERR_JS_TIMEOUT
+			}
+		}()
+	}
+
+	val, err := e.vm.Run(code)
+	if err != nil {
+		return "", err
+	}
+	return checkOutput(e.limits, val.String())
+}
+
+func (e *ottoEngine) Assign(name string, code string, ref string) (string, error) {
+	return e.Eval(name+" = "+code, ref)
+}
+
+func (e *ottoEngine) Template(template string, ref string) (string, error) {
+	return interpolate(e, template, ref)
+}
+
+func (e *ottoEngine) Get(name string) (string, error) {
+	return e.Eval("JSON.stringify("+name+")", "get.js")
+}
+
+func (e *ottoEngine) Set(name string, json string) error {
+	_, err := e.Eval(name+" = "+json+";", "set.js")
+	return err
+}
+
+func (e *ottoEngine) Load(src string, ref string) error {
+	_, err := e.Eval(src, ref)
+	return err
+}
+
+func (e *ottoEngine) Close() {
+}
@@ -0,0 +1,110 @@
+//go:build cgo
+// +build cgo
+
+package app
+
+import (
+	"time"
+
+	"rogchap.com/v8go"
+)
+
+type v8goEngine struct {
+	iso    *v8go.Isolate
+	ctx    *v8go.Context
+	limits JSLimits
+}
+
+func init() {
+	JS_ENGINES["v8go"] = newV8goEngine
+}
+
+func newV8goEngine(host JSHost, limits JSLimits) (JSEngine, error) {
+	iso, err := v8go.NewIsolate()
+	if err != nil {
+		return nil, err
+	}
+	global, err := v8go.NewObjectTemplate(iso)
+	if err != nil {
+		return nil, err
+	}
+
+	hostFunc := func(name string, f func() float64) error {
+		tmpl, err := v8go.NewFunctionTemplate(iso, func(info *v8go.FunctionCallbackInfo) *v8go.Value {
+			val, _ := v8go.NewValue(iso, f())
+			return val
+		})
+		if err != nil {
+			return err
+		}
+		return global.Set(name, tmpl, v8go.ReadOnly)
+	}
+	if err = hostFunc("__now", host.Now); err != nil {
+		return nil, err
+	}
+	if err = hostFunc("__random", host.Random); err != nil {
+		return nil, err
+	}
+
+	ctx, err := v8go.NewContext(iso, global)
+	if err != nil {
+		return nil, err
+	}
+	return &v8goEngine{iso: iso, ctx: ctx, limits: limits}, nil
+}
+
+// The isolate is terminated when the timeout fires. v8go has no API to cap the heap, so it's checked once the
+// evaluation is done: an evaluation can only grow it up to V8's own limit within its timeout
+func (e *v8goEngine) Eval(code string, ref string) (string, error) {
+	var timer *time.Timer
+	fired := make(chan struct{})
+	if e.limits.Timeout > 0 {
+		timer = time.AfterFunc(e.limits.Timeout, func() {
+			e.iso.TerminateExecution()
+			close(fired)
+		})
+	}
+
+	val, err := e.ctx.RunScript(code, ref)
+	if timer != nil && !timer.Stop() {
+		// It may have fired after the script was done, and a termination requested while no script runs can stop
+		// the next one. A script of our own takes it
+		<-fired
+		e.ctx.RunScript("undefined", "terminated.js")
+		return "", ERR_JS_TIMEOUT
+	}
+	if err != nil {
+		return "", err
+	}
+	if e.limits.MaxHeap > 0 && e.iso.GetHeapStatistics().UsedHeapSize > e.limits.MaxHeap {
+		return "", ERR_JS_HEAP
+	}
+	return checkOutput(e.limits, val.String())
+}
+
+func (e *v8goEngine) Assign(name string, code string, ref string) (string, error) {
+	return e.Eval(name+" = "+code, ref)
+}
+
+func (e *v8goEngine) Template(template string, ref string) (string, error) {
+	return e.Eval("`"+template+"`", ref)
+}
+
+func (e *v8goEngine) Get(name string) (string, error) {
+	return e.Eval("JSON.stringify("+name+")", "get.js")
+}
+
+func (e *v8goEngine) Set(name string, json string) error {
+	_, err := e.Eval(name+" = "+json+";", "set.js")
+	return err
+}
+
+func (e *v8goEngine) Load(src string, ref string) error {
+	_, err := e.Eval(src, ref)
+	return err
+}
+
+func (e *v8goEngine) Close() {
+	e.ctx.Close()
+	e.iso.Dispose()
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"errors"
+
+	"go.temporal.io/sdk/temporal"
+)
+
+// Error kinds that can be named in retry.nonretryable and except.errors. Activities can return their own kinds as
+// the type of a temporal application error (e.g. HttpError)
+const (
+	ERROR_KIND_ACTIVITY = "ActivityError" // Application error without a type
+	ERROR_KIND_TIMEOUT  = "TimeoutError"
+	ERROR_KIND_CANCELED = "CanceledError"
+	ERROR_KIND_HTTP     = "HttpError"
+	ERROR_KIND_ARGS     = "ArgsError"
+	ERROR_KIND_WORKFLOW = "WorkflowError" // Raised by the engine itself, e.g. a for over something that isn't an array
+	ERROR_KIND_JS       = "JSError"       // Expressions of the run failed, the details are the list of errors
+	ERROR_KIND_JS_LIMIT = "JSLimitError"  // An evaluation hit JS_TIMEOUT_MS or JS_MAX_HEAP_MB, never caught by except
+	ERROR_KIND_OUTPUT   = "OutputError"   // The return value doesn't match the output schema, one detail per mismatch
+)
+
+// StepError remembers which step failed
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return "step " + e.Step + ": " + e.Err.Error()
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Find the kind of an error returned by a step
+func errorKind(err error) string {
+	var appErr *temporal.ApplicationError
+	if errors.As(err, &appErr) {
+		if appErr.Type() == "" {
+			return ERROR_KIND_ACTIVITY
+		}
+		return appErr.Type()
+	}
+	if temporal.IsTimeoutError(err) {
+		return ERROR_KIND_TIMEOUT
+	}
+	if temporal.IsCanceledError(err) {
+		return ERROR_KIND_CANCELED
+	}
+	return ERROR_KIND_WORKFLOW
+}
+
+// The message of the innermost error without the temporal activity/step prefixes
+func errorMessage(err error) string {
+	var appErr *temporal.ApplicationError
+	if errors.As(err, &appErr) {
+		return appErr.Error()
+	}
+	for errors.Unwrap(err) != nil {
+		err = errors.Unwrap(err)
+	}
+	return err.Error()
+}
+
+// The { kind, message, step } object bound to JS for except and finally steps
+func errorObject(err error) map[string]string {
+	failed := ""
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		failed = stepErr.Step
+	}
+	return map[string]string{"kind": errorKind(err), "message": errorMessage(err), "step": failed}
+}
@@ -4,7 +4,7 @@ go 1.13
 
 require (
 	github.com/Jeffail/gabs/v2 v2.6.1 // indirect
-	github.com/dop251/goja v0.0.0-20210427212725-462d53687b0d // indirect
+	github.com/dop251/goja v0.0.0-20210427212725-462d53687b0d
 	github.com/emirpasic/gods v1.12.0 // indirect
 	github.com/gin-gonic/gin v1.7.2
 	github.com/go-playground/validator/v10 v10.6.1 // indirect
@@ -16,10 +16,14 @@ require (
 	github.com/modern-go/reflect2 v1.0.1 // indirect
 	github.com/pborman/uuid v1.2.1
 	github.com/robertkrimen/otto v0.0.0-20200922221731-ef014fd054ac
+	github.com/robfig/cron v1.2.0
 	github.com/ugorji/go v1.2.6 // indirect
+	go.etcd.io/bbolt v1.3.6
+	go.temporal.io/api v1.4.1-0.20210318194442-3f93fcec559f
 	go.temporal.io/sdk v1.6.0
 	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a // indirect
 	golang.org/x/sys v0.0.0-20210521203332-0cec03c779c1 // indirect
 	gopkg.in/sourcemap.v1 v1.0.5 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 	rogchap.com/v8go v0.6.0
 )
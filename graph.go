@@ -0,0 +1,367 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Output formats of a graph
+var GRAPH_FORMATS = []string{"dot", "mermaid"}
+
+// IDs of the terminal nodes. Upper case, end is a keyword in mermaid
+const (
+	GRAPH_START = "START"
+	GRAPH_END   = "END"
+)
+
+// Kinds of graph edges
+const (
+	EDGE_FLOW   = "flow"   // Falls through to the next activity
+	EDGE_NEXT   = "next"   // next of a step
+	EDGE_SWITCH = "switch" // Condition of a switch, the label
+	EDGE_JUMP   = "jump"   // timeout_next of a wait.signal, escalate of an approval
+	EDGE_RETURN = "return"
+	EDGE_BODY   = "body" // Into and out of the steps a step runs itself: for, parallel, try, approval notify
+)
+
+type (
+	// Control flow of a definition: every step is a node, in the order of the activities (depth first). Steps that
+	// run their own steps (for, parallel...) get a cluster with them
+	GraphT struct {
+		Name     string
+		Nodes    []*GraphNode
+		Edges    []*GraphEdge
+		Clusters []*GraphCluster
+	}
+
+	GraphNode struct {
+		ID          string
+		Label       string
+		Cluster     string // ID of the cluster, "" at the top
+		Terminal    bool   // start and end
+		Return      bool
+		Unreachable bool
+	}
+
+	GraphEdge struct {
+		From  string
+		To    string
+		Label string
+		Kind  string
+	}
+
+	GraphCluster struct {
+		ID     string
+		Label  string
+		Parent string
+	}
+)
+
+// Graph of the steps, finally steps included. Unreachable steps are the ones no edge leads to from the start
+func (wf *WF) Graph() *GraphT {
+	g := &GraphT{Name: wf.Name}
+	g.Nodes = append(g.Nodes, &GraphNode{ID: GRAPH_START, Label: "start", Terminal: true})
+
+	exit := GRAPH_END
+	if len(wf.Finally) > 0 {
+		exit = "finally_0" // First node of the finally cluster below
+	}
+	entry := g.scope(wf.Steps, "", "n", exit)
+	g.Edges = append([]*GraphEdge{{From: GRAPH_START, To: entry, Kind: EDGE_FLOW}}, g.Edges...)
+	if len(wf.Finally) > 0 {
+		g.Clusters = append(g.Clusters, &GraphCluster{ID: "finally", Label: "finally"})
+		g.scope(wf.Finally, "finally", "finally_", GRAPH_END)
+	}
+	g.Nodes = append(g.Nodes, &GraphNode{ID: GRAPH_END, Label: "end", Terminal: true})
+	g.markUnreachable()
+	return g
+}
+
+// Add the nodes and edges of steps that run as one (sub) workflow, and jump to each other by name. Returns the ID of
+// the first node, exit when there are no steps
+func (g *GraphT) scope(steps []*Step, cluster string, prefix string, exit string) string {
+	body := &WF{Steps: cloneSteps(steps)}
+	body.createActivitiesFromSteps()
+	acts := body.Activities
+	if len(acts) == 0 {
+		return exit
+	}
+
+	ids := make([]string, len(acts))
+	index := make(map[string]int)
+	for i, s := range acts {
+		ids[i] = prefix + strconv.Itoa(i)
+		if _, ok := index[s.Name]; !ok {
+			index[s.Name] = i // Jumps go to the first step with the name, like findStepIndex
+		}
+	}
+	target := func(name string) (string, bool) {
+		i, ok := index[name]
+		return ids[i], ok
+	}
+
+	for i, s := range acts {
+		id := ids[i]
+		g.Nodes = append(g.Nodes, &GraphNode{ID: id, Label: stepLabel(s), Cluster: cluster, Return: s.Return != ""})
+		g.bodies(s, id, cluster)
+
+		if s.Timeout_next != "" {
+			if to, ok := target(s.Timeout_next); ok {
+				g.edge(id, to, "timeout", EDGE_JUMP)
+			}
+		}
+		if s.Approval != nil && s.Approval.Escalate != "" {
+			if to, ok := target(s.Approval.Escalate); ok {
+				g.edge(id, to, "expired", EDGE_JUMP)
+			}
+		}
+		if s.Return != "" {
+			g.edge(id, exit, "return", EDGE_RETURN)
+			continue
+		}
+
+		var switches []SwitchT
+		json.Unmarshal(s.Switch, &switches)
+		for _, sw := range switches {
+			if to, ok := target(sw.Next); ok {
+				g.edge(id, to, sw.Condition, EDGE_SWITCH)
+			}
+		}
+		label := ""
+		if len(switches) > 0 {
+			label = "else"
+		}
+		if to, ok := target(s.Next); ok && s.Next != "" {
+			if label == "" {
+				label = "next"
+			}
+			g.edge(id, to, label, EDGE_NEXT)
+			continue
+		}
+		next := exit
+		if i+1 < len(acts) {
+			next = ids[i+1]
+		}
+		g.edge(id, next, label, EDGE_FLOW)
+	}
+	return ids[0]
+}
+
+// Clusters of the steps a step runs itself. Their flow goes back to the step when done
+func (g *GraphT) bodies(s *Step, id string, cluster string) {
+	add := func(steps []*Step, suffix string, label string) {
+		if len(steps) == 0 {
+			return
+		}
+		c := &GraphCluster{ID: id + suffix, Label: label, Parent: cluster}
+		g.Clusters = append(g.Clusters, c)
+		g.edge(id, c.ID+"_0", label, EDGE_BODY) // First node of the cluster
+		g.scope(steps, c.ID, c.ID+"_", id)
+	}
+	if s.For != nil {
+		add(s.Children, "_for", "for "+s.For.Value+" in "+s.For.In)
+	}
+	if s.Parallel != nil {
+		for i, b := range s.Parallel.Branches {
+			add(b.Steps, "_b"+strconv.Itoa(i), "branch "+b.Name)
+		}
+	}
+	add(s.Try, "_try", "try")
+	if s.Except != nil {
+		add(s.Except.Steps, "_except", "except")
+	}
+	if s.Approval != nil {
+		add(s.Approval.Notify, "_notify", "notify")
+	}
+}
+
+func (g *GraphT) edge(from string, to string, label string, kind string) {
+	g.Edges = append(g.Edges, &GraphEdge{From: from, To: to, Label: label, Kind: kind})
+}
+
+func (g *GraphT) markUnreachable() {
+	next := make(map[string][]string)
+	for _, e := range g.Edges {
+		next[e.From] = append(next[e.From], e.To)
+	}
+	reached := map[string]bool{GRAPH_START: true}
+	todo := []string{GRAPH_START}
+	for len(todo) > 0 {
+		id := todo[0]
+		todo = todo[1:]
+		for _, to := range next[id] {
+			if !reached[to] {
+				reached[to] = true
+				todo = append(todo, to)
+			}
+		}
+	}
+	for _, n := range g.Nodes {
+		n.Unreachable = !reached[n.ID]
+	}
+}
+
+// Name and what the step does, e.g. "getTime\nhttp.get"
+func stepLabel(s *Step) string {
+	kind := s.Call
+	switch {
+	case s.Parallel != nil:
+		kind = "parallel"
+	case s.For != nil:
+		kind = "for"
+	case len(s.Try) > 0:
+		kind = "try"
+	case s.Approval != nil:
+		kind = "approval"
+	case kind == "" && len(s.Assign) > 0:
+		kind = "assign"
+	}
+	label := s.Name
+	if kind != "" {
+		label += "\n" + kind
+	}
+	if s.Return != "" {
+		label += "\nreturn " + s.Return
+	}
+	return label
+}
+
+// The graph in one of GRAPH_FORMATS
+func (g *GraphT) Format(format string) (string, error) {
+	switch format {
+	case "dot", "":
+		return g.DOT(), nil
+	case "mermaid":
+		return g.Mermaid(), nil
+	}
+	return "", errors.New("unknown graph format " + strconv.Quote(format) + ", expected " + strings.Join(GRAPH_FORMATS, " or "))
+}
+
+// Graphviz, e.g. dot -Tsvg
+func (g *GraphT) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph " + strconv.Quote(g.Name) + " {\n")
+	b.WriteString("  node [shape=box, style=rounded];\n")
+	var nodes func(cluster string, indent string)
+	nodes = func(cluster string, indent string) {
+		for _, n := range g.Nodes {
+			if n.Cluster != cluster {
+				continue
+			}
+			attrs := "label=" + dotQuote(n.Label)
+			switch {
+			case n.ID == GRAPH_START:
+				attrs += ", shape=circle"
+			case n.Terminal:
+				attrs += ", shape=doublecircle"
+			case n.Return:
+				attrs += ", peripheries=2"
+			}
+			if n.Unreachable {
+				attrs += ", style=\"rounded,dashed\", color=gray, fontcolor=gray"
+			}
+			b.WriteString(indent + n.ID + " [" + attrs + "];\n")
+		}
+		for _, c := range g.Clusters {
+			if c.Parent != cluster {
+				continue
+			}
+			b.WriteString(indent + "subgraph cluster_" + c.ID + " {\n")
+			b.WriteString(indent + "  label=" + dotQuote(c.Label) + ";\n")
+			nodes(c.ID, indent+"  ")
+			b.WriteString(indent + "}\n")
+		}
+	}
+	nodes("", "  ")
+	for _, e := range g.Edges {
+		var attrs []string
+		if e.Label != "" {
+			attrs = append(attrs, "label="+dotQuote(e.Label))
+		}
+		switch e.Kind {
+		case EDGE_BODY:
+			attrs = append(attrs, "style=dashed")
+		case EDGE_JUMP:
+			attrs = append(attrs, "style=dotted")
+		case EDGE_RETURN:
+			attrs = append(attrs, "color=gray")
+		}
+		line := "  " + e.From + " -> " + e.To
+		if len(attrs) > 0 {
+			line += " [" + strings.Join(attrs, ", ") + "]"
+		}
+		b.WriteString(line + ";\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return "\"" + strings.ReplaceAll(s, "\n", "\\n") + "\""
+}
+
+// Mermaid flowchart, renders in GitHub markdown
+func (g *GraphT) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	var nodes func(cluster string, indent string)
+	nodes = func(cluster string, indent string) {
+		for _, n := range g.Nodes {
+			if n.Cluster != cluster {
+				continue
+			}
+			switch {
+			case n.ID == GRAPH_START:
+				b.WriteString(indent + n.ID + "((" + mermaidQuote(n.Label) + "))\n")
+			case n.Terminal:
+				b.WriteString(indent + n.ID + "(((" + mermaidQuote(n.Label) + ")))\n")
+			case n.Return:
+				b.WriteString(indent + n.ID + "([" + mermaidQuote(n.Label) + "])\n")
+			default:
+				b.WriteString(indent + n.ID + "[" + mermaidQuote(n.Label) + "]\n")
+			}
+		}
+		for _, c := range g.Clusters {
+			if c.Parent != cluster {
+				continue
+			}
+			b.WriteString(indent + "subgraph " + c.ID + " [" + mermaidQuote(c.Label) + "]\n")
+			nodes(c.ID, indent+"  ")
+			b.WriteString(indent + "end\n")
+		}
+	}
+	nodes("", "  ")
+	for _, e := range g.Edges {
+		arrow := "-->"
+		switch e.Kind {
+		case EDGE_BODY, EDGE_JUMP:
+			arrow = "-.->"
+		}
+		if e.Label != "" {
+			arrow += "|" + mermaidQuote(e.Label) + "|"
+		}
+		b.WriteString("  " + e.From + " " + arrow + " " + e.To + "\n")
+	}
+	var unreachable []string
+	for _, n := range g.Nodes {
+		if n.Unreachable {
+			unreachable = append(unreachable, n.ID)
+		}
+	}
+	if len(unreachable) > 0 {
+		b.WriteString("  classDef unreachable stroke-dasharray: 5 5, color:#999\n")
+		b.WriteString("  class " + strings.Join(unreachable, ",") + " unreachable\n")
+	}
+	return b.String()
+}
+
+// Labels are always quoted, quotes and | (ends an edge label) become entities and new lines <br/>
+func mermaidQuote(s string) string {
+	s = strings.ReplaceAll(s, "\"", "#quot;")
+	s = strings.ReplaceAll(s, "|", "#124;")
+	return "\"" + strings.ReplaceAll(s, "\n", "<br/>") + "\""
+}
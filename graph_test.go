@@ -0,0 +1,235 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func testGraph(t *testing.T, def string) *GraphT {
+	t.Helper()
+	wf, err := NEW_WF([]byte(def))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wf.Graph()
+}
+
+// "from -> to label (kind)" of every edge, in order
+func graphEdges(g *GraphT) []string {
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+" -> "+e.To+" "+e.Label+" ("+e.Kind+")")
+	}
+	return edges
+}
+
+func TestGraphEdges(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		def      string
+		expected []string
+	}{
+		{"fall through", `{"name":"G","steps":[{"name":"a","call":"noops"},{"name":"b","assign":{"x":"1"}}]}`, []string{
+			"START -> n0  (flow)",
+			"n0 -> n1  (flow)",
+			"n1 -> END  (flow)",
+		}},
+		{"switch", `{"name":"G","steps":[
+			{"name":"check","switch":[{"condition":"x > 1","next":"big"},{"condition":"x < 0","next":"neg"}],"next":"small"},
+			{"name":"small","return":"'s'"},{"name":"big","return":"'b'"},{"name":"neg","return":"'n'"}]}`, []string{
+			"START -> n0  (flow)",
+			"n0 -> n2 x > 1 (switch)",
+			"n0 -> n3 x < 0 (switch)",
+			"n0 -> n1 else (next)",
+			"n1 -> END return (return)",
+			"n2 -> END return (return)",
+			"n3 -> END return (return)",
+		}},
+		// Without next a step with a switch falls through when no condition is true
+		{"switch falls through", `{"name":"G","steps":[{"name":"check","switch":[{"condition":"x","next":"done"}]},{"name":"other","call":"noops"},{"name":"done","return":"1"}]}`, []string{
+			"START -> n0  (flow)",
+			"n0 -> n2 x (switch)",
+			"n0 -> n1 else (flow)",
+			"n1 -> n2  (flow)",
+			"n2 -> END return (return)",
+		}},
+		{"next", `{"name":"G","steps":[{"name":"a","call":"noops","next":"c"},{"name":"b","call":"noops"},{"name":"c","call":"noops","next":"a"}]}`, []string{
+			"START -> n0  (flow)",
+			"n0 -> n2 next (next)",
+			"n1 -> n2  (flow)",
+			"n2 -> n0 next (next)",
+		}},
+		{"timeout next", `{"name":"G","steps":[{"name":"wait","call":"wait.signal","args":{"timeout":60},"timeout_next":"late"},{"name":"ok","return":"1"},{"name":"late","return":"0"}]}`, []string{
+			"START -> n0  (flow)",
+			"n0 -> n2 timeout (jump)",
+			"n0 -> n1  (flow)",
+			"n1 -> END return (return)",
+			"n2 -> END return (return)",
+		}},
+		// Returns end the run through its finally steps
+		{"return to finally", `{"name":"G","steps":[{"name":"a","return":"1"}],"finally":[{"name":"f","call":"noops"}]}`, []string{
+			"START -> n0  (flow)",
+			"n0 -> finally_0 return (return)",
+			"finally_0 -> END  (flow)",
+		}},
+		// Bodies flow back to their step, a return in a body ends the body only
+		{"parallel", `{"name":"G","steps":[{"name":"p","parallel":{"branches":[
+			{"name":"x","steps":[{"name":"a","call":"noops"}]},{"name":"y","steps":[{"name":"b","return":"2"}]}]}}]}`, []string{
+			"START -> n0  (flow)",
+			"n0 -> n0_b0_0 branch x (body)",
+			"n0_b0_0 -> n0  (flow)",
+			"n0 -> n0_b1_0 branch y (body)",
+			"n0_b1_0 -> n0 return (return)",
+			"n0 -> END  (flow)",
+		}},
+		{"for", `{"name":"G","steps":[{"name":"f","for":{"in":"items","value":"item"},"children":[{"name":"a","call":"noops"},{"name":"b","call":"noops"}]}]}`, []string{
+			"START -> n0  (flow)",
+			"n0 -> n0_for_0 for item in items (body)",
+			"n0_for_0 -> n0_for_1  (flow)",
+			"n0_for_1 -> n0  (flow)",
+			"n0 -> END  (flow)",
+		}},
+		{"try", `{"name":"G","steps":[{"name":"t","try":[{"name":"a","call":"noops"}],"except":{"steps":[{"name":"b","call":"noops"}]}}]}`, []string{
+			"START -> n0  (flow)",
+			"n0 -> n0_try_0 try (body)",
+			"n0_try_0 -> n0  (flow)",
+			"n0 -> n0_except_0 except (body)",
+			"n0_except_0 -> n0  (flow)",
+			"n0 -> END  (flow)",
+		}},
+	} {
+		edges := graphEdges(testGraph(t, c.def))
+		if strings.Join(edges, "\n") != strings.Join(c.expected, "\n") {
+			t.Errorf("%s:\n%s\nexpected:\n%s", c.name, strings.Join(edges, "\n"), strings.Join(c.expected, "\n"))
+		}
+	}
+}
+
+func TestGraphClusters(t *testing.T) {
+	g := testGraph(t, `{"name":"G","steps":[
+		{"name":"p","parallel":{"branches":[{"name":"x","steps":[
+			{"name":"f","for":{"in":"items","value":"item"},"children":[{"name":"a","call":"noops"}]}]}]}},
+		{"name":"t","try":[{"name":"b","call":"noops"}],"except":{"steps":[{"name":"c","call":"noops"}]}}],
+		"finally":[{"name":"d","call":"noops"}]}`)
+	var clusters []string
+	for _, c := range g.Clusters {
+		clusters = append(clusters, c.ID+" "+c.Label+" in "+c.Parent)
+	}
+	expected := []string{
+		"n0_b0 branch x in ",
+		"n0_b0_0_for for item in items in n0_b0",
+		"n1_try try in ",
+		"n1_except except in ",
+		"finally finally in ",
+	}
+	if strings.Join(clusters, "\n") != strings.Join(expected, "\n") {
+		t.Error(clusters)
+	}
+	clusterOf := make(map[string]string)
+	for _, n := range g.Nodes {
+		clusterOf[n.ID] = n.Cluster
+	}
+	for id, cluster := range map[string]string{"n0": "", "n0_b0_0": "n0_b0", "n0_b0_0_for_0": "n0_b0_0_for", "n1_except_0": "n1_except", "finally_0": "finally"} {
+		if clusterOf[id] != cluster {
+			t.Error(id, clusterOf[id])
+		}
+	}
+
+	dot := g.DOT()
+	for _, s := range []string{
+		"  subgraph cluster_n0_b0 {\n    label=\"branch x\";\n    n0_b0_0 [label=\"f\\nfor\"];\n    subgraph cluster_n0_b0_0_for {\n",
+		"  n0 -> n0_b0_0 [label=\"branch x\", style=dashed];\n",
+		"  subgraph cluster_finally {\n    label=\"finally\";\n    finally_0 [label=\"d\\nnoops\"];\n  }\n",
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("dot has no %q:\n%s", s, dot)
+		}
+	}
+	mermaid := g.Mermaid()
+	for _, s := range []string{
+		"  subgraph n0_b0 [\"branch x\"]\n    n0_b0_0[\"f<br/>for\"]\n    subgraph n0_b0_0_for [\"for item in items\"]\n",
+		"  n0 -.->|\"branch x\"| n0_b0_0\n",
+		"  subgraph finally [\"finally\"]\n    finally_0[\"d<br/>noops\"]\n  end\n",
+	} {
+		if !strings.Contains(mermaid, s) {
+			t.Errorf("mermaid has no %q:\n%s", s, mermaid)
+		}
+	}
+}
+
+func TestGraphUnreachable(t *testing.T) {
+	g := testGraph(t, `{"name":"G","steps":[
+		{"name":"a","call":"noops","next":"c"},{"name":"skipped","call":"noops"},{"name":"c","return":"1"},{"name":"after","call":"noops"}]}`)
+	var unreachable []string
+	for _, n := range g.Nodes {
+		if n.Unreachable {
+			unreachable = append(unreachable, n.ID)
+		}
+	}
+	if strings.Join(unreachable, ",") != "n1,n3" {
+		t.Error(unreachable)
+	}
+
+	dot := g.DOT()
+	for _, s := range []string{
+		`n1 [label="skipped\nnoops", style="rounded,dashed", color=gray, fontcolor=gray];`,
+		`n3 [label="after\nnoops", style="rounded,dashed", color=gray, fontcolor=gray];`,
+		`n2 [label="c\nreturn 1", peripheries=2];`,
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("dot has no %s:\n%s", s, dot)
+		}
+	}
+	if !strings.Contains(g.Mermaid(), "  classDef unreachable stroke-dasharray: 5 5, color:#999\n  class n1,n3 unreachable\n") {
+		t.Error(g.Mermaid())
+	}
+
+	// Every step is reached, no class
+	if strings.Contains(testGraph(t, `{"name":"G","steps":[{"name":"a","call":"noops"}]}`).Mermaid(), "unreachable") {
+		t.Error("unreachable class without unreachable steps")
+	}
+}
+
+func TestGraphQuote(t *testing.T) {
+	for _, c := range []struct {
+		label   string
+		dot     string
+		mermaid string
+	}{
+		{`plain`, `"plain"`, `"plain"`},
+		{`say "hi"`, `"say \"hi\""`, `"say #quot;hi#quot;"`},
+		{"two\nlines", `"two\nlines"`, `"two<br/>lines"`},
+		{`a \ b`, `"a \\ b"`, `"a \ b"`},
+		{`x || y`, `"x || y"`, `"x #124;#124; y"`},
+		{`items[0] (first) {a}`, `"items[0] (first) {a}"`, `"items[0] (first) {a}"`},
+		{`"]` + "\n" + `|`, `"\"]\n|"`, `"#quot;]<br/>#124;"`},
+	} {
+		if q := dotQuote(c.label); q != c.dot {
+			t.Errorf("dot %q: %s, expected %s", c.label, q, c.dot)
+		}
+		if q := mermaidQuote(c.label); q != c.mermaid {
+			t.Errorf("mermaid %q: %s, expected %s", c.label, q, c.mermaid)
+		}
+	}
+
+	// Labels of switch conditions end up in both outputs
+	g := testGraph(t, `{"name":"say \"G\"","steps":[{"name":"a","switch":[{"condition":"s == \"|\" || t[0]","next":"b"}]},{"name":"b","return":"1"}]}`)
+	if dot := g.DOT(); !strings.HasPrefix(dot, `digraph "say \"G\"" {`) || !strings.Contains(dot, `n0 -> n1 [label="s == \"|\" || t[0]"];`) {
+		t.Error(dot)
+	}
+	if mermaid := g.Mermaid(); !strings.Contains(mermaid, `n0 -->|"s == #quot;#124;#quot; #124;#124; t[0]"| n1`) {
+		t.Error(mermaid)
+	}
+}
+
+func TestGraphFormat(t *testing.T) {
+	g := testGraph(t, `{"name":"G","steps":[{"name":"a","call":"noops"}]}`)
+	for format, prefix := range map[string]string{"": "digraph", "dot": "digraph", "mermaid": "flowchart TD"} {
+		if out, err := g.Format(format); err != nil || !strings.HasPrefix(out, prefix) {
+			t.Error(format, out, err)
+		}
+	}
+	if _, err := g.Format("svg"); err == nil || !strings.Contains(err.Error(), "dot or mermaid") {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+type (
+	// Expression engine that runs the JS of a workflow (assign, args, switch, match, return). Results are returned
+	// as strings, the same as String(result) in JS
+	JSEngine interface {
+		Eval(code string, ref string) (string, error)
+		Assign(name string, code string, ref string) (string, error) // name = code
+		Template(template string, ref string) (string, error)        // "abc${2+3}def" => "abc5def"
+		Get(name string) (string, error)                             // JSON of a variable
+		Set(name string, json string) error                          // name = JSON value
+		Load(src string, ref string) error                           // Library like z.js, run in the global scope
+		Close()
+	}
+
+	// Go functions every engine exposes to the JS as __now and __random
+	JSHost struct {
+		Now    func() float64
+		Random func() float64
+	}
+)
+
+// Available engines by name. v8go needs cgo and registers itself when it's built
+var JS_ENGINES = map[string]func(host JSHost, limits JSLimits) (JSEngine, error){
+	"goja": newGojaEngine,
+	"otto": newOttoEngine,
+}
+
+// Engine used by this process, from the JS_ENGINE env var. Empty => v8go when available, else goja
+var JS_ENGINE = ""
+
+// Constructor function to create a JS engine by name
+func NEW_JS_ENGINE(name string, host JSHost, limits JSLimits) (JSEngine, error) {
+	if name == "" {
+		name = "goja"
+		if _, ok := JS_ENGINES["v8go"]; ok {
+			name = "v8go"
+		}
+	}
+	create, ok := JS_ENGINES[name]
+	if !ok {
+		var names []string
+		for n := range JS_ENGINES {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, errors.New("Unknown JS engine " + name + ", available: " + strings.Join(names, ", "))
+	}
+	return create(host, limits)
+}
+
+// Interpolate each ${} of a template on its own, for engines without template literals
+func interpolate(js JSEngine, template string, ref string) (string, error) {
+	var firstErr error
+	out := R_IS_JS.ReplaceAllStringFunc(template, func(m string) string {
+		val, err := js.Eval("String("+m[2:len(m)-1]+")", ref)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return val
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return out, nil
+}
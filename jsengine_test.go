@@ -0,0 +1,59 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// A definition that doesn't use match gives the same result on every engine
+func TestEnginesAgree(t *testing.T) {
+	def := `{"name":"E","steps":[
+		{"name":"init","assign":[{"who":"'World'"},{"n":"[3, 1, 2].sort()"},{"total":"n.reduce(function (a, b) { return a + b; }, 0)"}]},
+		{"name":"post","call":"http.post","args":{"url":"http://x/${total}","body":{"greeting":"Hello ${who}!","first":"${n[0]}"}},"result":"res"},
+		{"name":"check","switch":[{"condition":"total > 5","next":"big"}]},
+		{"name":"small","return":"'small'"},
+		{"name":"big","return":"({ url: res.url, body: res.body, total: total, text: 'n=' + n.join(',') })"}]}`
+	mocks := testMocks{
+		"http.post": func(step *Step) (string, error) {
+			bs, err := json.Marshal(step.Args)
+			return string(bs), err
+		},
+	}
+	expected := `{"body":{"first":"1","greeting":"Hello World!"},"text":"n=1,2,3","total":6,"url":"http://x/6"}`
+	if len(JS_ENGINES) < 2 {
+		t.Fatal(JS_ENGINES)
+	}
+	for name := range JS_ENGINES {
+		res, err := runTestWFEngine(t, name, def, mocks)
+		if err != nil {
+			t.Error(name, err)
+		} else if res != expected {
+			t.Error(name, res)
+		}
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	for name, create := range JS_ENGINES {
+		js, err := create(JSHost{Now: func() float64 { return 0 }, Random: func() float64 { return 0 }}, JSLimits{})
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		js.Eval("var a = 2, s = 'x';", "init.js")
+		for template, expected := range map[string]string{
+			"abc${a+3}def":   "abc5def",
+			"${s}-${s}":      "x-x",
+			"no expressions": "no expressions",
+			"${[1, 2]}":      "1,2",
+		} {
+			got, err := js.Template(template, "template.js")
+			if err != nil || got != expected {
+				t.Error(name, template, got, err)
+			}
+		}
+		if _, err := js.Template("${missing}", "template.js"); err == nil {
+			t.Error(name, "undefined variable in a template")
+		}
+		js.Close()
+	}
+}
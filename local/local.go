@@ -0,0 +1,147 @@
+// Package local runs definitions in process on the Temporal test environment, for wfctl run --local and Go tests.
+// It is kept out of app so that the worker and the server don't link the SDK testsuite
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	sdklog "go.temporal.io/sdk/log"
+	"go.temporal.io/sdk/testsuite"
+
+	"workflow_engine/app"
+)
+
+// Real time a local run can take, timers and sleeps are skipped and don't count
+const TIMEOUT = 10 * time.Minute
+
+type (
+	// Mocks are the results of activities by step name or call (e.g. "http.get"), the step name wins. A string is
+	// the raw result, an error fails the step and anything else is sent as JSON. Activities without a mock run for
+	// real. Signals are sent after their delay in workflow time, so wait.signal and approval steps can be run too
+	Options struct {
+		Mocks   map[string]interface{}
+		Signals []Signal
+		Timeout time.Duration
+		Logger  sdklog.Logger // Of the test environment, default the SDK logger on stdout
+	}
+
+	// A signal named Name, or the decision of the approval step Approval (Payload is then an app.ApprovalDecision).
+	// The token of an approval is random, so the signal is looked up in the state of the run when it's sent
+	Signal struct {
+		Name     string
+		Approval string
+		Delay    time.Duration
+		Payload  interface{}
+	}
+
+	// The return value and the steps of a local run
+	Result struct {
+		Result interface{}
+		State  *app.RunState
+	}
+)
+
+// Run a definition through the same WorkflowEngineMain as the worker. Timers fire right away and child workflows run
+// in process too. app.InitWorkflowGlobals must have been called
+func Run(wf app.WF, opts Options) (Result, error) {
+	var res Result
+	s := &testsuite.WorkflowTestSuite{}
+	if opts.Logger != nil {
+		s.SetLogger(opts.Logger)
+	}
+	env := s.NewTestWorkflowEnvironment()
+	if opts.Timeout <= 0 {
+		opts.Timeout = TIMEOUT
+	}
+	env.SetTestTimeout(opts.Timeout)
+
+	env.RegisterWorkflow(app.WorkflowEngineMain)
+	a := &app.ActivityType{}
+	activities := map[string]func(ctx context.Context, step *app.Step) (string, error){
+		"NopActivity": a.NopActivity,
+		"CallHttp":    a.CallHttp,
+		"HttpRequest": a.HttpRequest,
+	}
+	for name, real := range activities {
+		real := real
+		env.RegisterActivityWithOptions(func(ctx context.Context, step *app.Step) (string, error) {
+			if result, ok := opts.mock(step); ok {
+				log.Println("LOCAL: mocked ", step.Name)
+				return mockResult(result)
+			}
+			return real(ctx, step)
+		}, activity.RegisterOptions{Name: name})
+	}
+	env.RegisterActivity(a.Sleep)
+	env.RegisterActivity(a.LoadDefinition)
+
+	for _, signal := range opts.Signals {
+		signal := signal
+		env.RegisterDelayedCallback(func() {
+			name := signal.Name
+			if signal.Approval != "" {
+				name = approvalSignal(env, signal.Approval)
+				if name == "" {
+					log.Println("LOCAL: no pending approval ", signal.Approval)
+					return
+				}
+			}
+			env.SignalWorkflow(name, signal.Payload)
+		}, signal.Delay)
+	}
+
+	env.ExecuteWorkflow(app.WorkflowEngineMain, wf)
+	if !env.IsWorkflowCompleted() {
+		return res, errors.New("local run didn't complete within " + opts.Timeout.String())
+	}
+	if val, err := env.QueryWorkflow(app.QUERY_STATE); err == nil {
+		val.Get(&res.State)
+	}
+	if err := env.GetWorkflowError(); err != nil {
+		return res, err
+	}
+	err := env.GetWorkflowResult(&res.Result)
+	return res, err
+}
+
+// Signal the pending approval of a step waits on, "" when there's none
+func approvalSignal(env *testsuite.TestWorkflowEnvironment, step string) string {
+	val, err := env.QueryWorkflow(app.QUERY_STATE)
+	if err != nil {
+		return ""
+	}
+	var state app.RunState
+	if val.Get(&state) != nil {
+		return ""
+	}
+	for _, a := range state.Approvals {
+		if a.Step == step && a.Status == app.APPROVAL_PENDING {
+			return app.SIGNAL_APPROVAL + a.TokenHash
+		}
+	}
+	return ""
+}
+
+func (o *Options) mock(step *app.Step) (interface{}, bool) {
+	if result, ok := o.Mocks[step.Name]; ok {
+		return result, true
+	}
+	result, ok := o.Mocks[step.Call]
+	return result, ok
+}
+
+func mockResult(result interface{}) (string, error) {
+	switch r := result.(type) {
+	case error:
+		return "", r
+	case string:
+		return r, nil
+	}
+	bs, err := json.Marshal(result)
+	return string(bs), err
+}
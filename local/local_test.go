@@ -0,0 +1,103 @@
+package local
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"workflow_engine/app"
+)
+
+func newTestWF(t *testing.T, def string) app.WF {
+	t.Helper()
+	app.InitWorkflowGlobals()
+	wf, err := app.NEW_WF([]byte(def))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wf
+}
+
+func TestRunMocks(t *testing.T) {
+	wf := newTestWF(t, `{"name":"M","steps":[
+		{"name":"order","call":"http.post","args":{"url":"http://orders"},"result":"order"},
+		{"name":"stock","call":"http.post","args":{"url":"http://stock"},"result":"stock"},
+		{"name":"done","return":"({ id: order.id, left: stock.left })"}]}`)
+
+	// The step name wins over the call
+	res, err := Run(wf, Options{Mocks: map[string]interface{}{
+		"order":     map[string]interface{}{"id": 7},
+		"http.post": `{"left": 3}`,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, _ := res.Result.(map[string]interface{})
+	if result["id"] != 7.0 || result["left"] != 3.0 {
+		t.Error(res.Result)
+	}
+	if res.State == nil || len(res.State.Steps) != 3 || res.State.Steps[0].Name != "order" || res.State.Steps[0].Result != `{"id":7}` {
+		t.Error(res.State)
+	}
+}
+
+func TestRunMockError(t *testing.T) {
+	wf := newTestWF(t, `{"name":"E","retry":{"maxattempts":1},"steps":[
+		{"name":"order","call":"http.post","args":{"url":"http://orders"},"result":"order"},
+		{"name":"done","return":"order"}]}`)
+
+	res, err := Run(wf, Options{Mocks: map[string]interface{}{"order": errors.New("out of stock")}})
+	if err == nil || !strings.Contains(err.Error(), "out of stock") {
+		t.Fatal(err)
+	}
+	// The state is there for the steps before the failure
+	if res.State == nil || len(res.State.Steps) != 1 || !strings.Contains(res.State.Steps[0].Error, "out of stock") {
+		t.Error(res.State)
+	}
+}
+
+func TestRunSignals(t *testing.T) {
+	wf := newTestWF(t, `{"name":"S","steps":[
+		{"name":"waitPayment","call":"wait.signal","args":{"name":"payment","timeout":3600},"result":"payment","timeout_next":"expired"},
+		{"name":"paid","return":"payment.paid"},
+		{"name":"expired","return":"-1"}]}`)
+
+	res, err := Run(wf, Options{Signals: []Signal{
+		{Name: "payment", Delay: time.Minute, Payload: map[string]interface{}{"paid": 10}},
+	}})
+	if err != nil || res.Result != 10.0 {
+		t.Error(res.Result, err)
+	}
+
+	// Without the signal the timeout fires right away in workflow time
+	res, err = Run(wf, Options{})
+	if err != nil || res.Result != -1.0 {
+		t.Error(res.Result, err)
+	}
+}
+
+func TestRunApproval(t *testing.T) {
+	wf := newTestWF(t, `{"name":"A","steps":[
+		{"name":"signoff","approval":{"timeout":3600,"as":"a","notify":[
+			{"name":"mail","call":"http.post","args":{"url":"http://mail","body":{"link":"/api/v1/approvals/${a.token}"}}}
+		]}},
+		{"name":"done","return":"({ approved: a.approved, by: a.by })"}]}`)
+
+	res, err := Run(wf, Options{
+		Mocks: map[string]interface{}{"mail": "{}"},
+		Signals: []Signal{
+			{Approval: "signoff", Delay: time.Minute, Payload: app.ApprovalDecision{Approve: true, By: "boss"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, _ := res.Result.(map[string]interface{})
+	if result["approved"] != true || result["by"] != "boss" {
+		t.Error(res.Result)
+	}
+	if len(res.State.Approvals) != 1 || res.State.Approvals[0].Status != app.APPROVAL_APPROVED {
+		t.Error(res.State.Approvals)
+	}
+}
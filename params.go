@@ -0,0 +1,121 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// Input of a definition. Type is one of TYPE_NAMES, Default is used when the caller leaves it out
+type ParamT struct {
+	Name        string
+	Type        string
+	Default     interface{}
+	Required    bool
+	Description string
+}
+
+// Param types => the Var_Type categories findType detects
+var TYPE_NAMES = map[string]int{
+	"integer": TYPE_NAME_INTEGER,
+	"float":   TYPE_NAME_FLOAT,
+	"boolean": TYPE_NAME_BOOLEAN,
+	"json":    TYPE_NAME_JSON,
+	"string":  TYPE_NAME_STRING,
+}
+
+// Check the inputs of a run against the params, coerce them to their type and set them as variables, which are bound
+// to JS before the first step. Without params the inputs are set as they are
+func (wf *WF) ApplyParams(inputs map[string]interface{}) ValidationErrors {
+	var errs ValidationErrors
+	if wf.Variables == nil {
+		wf.Variables = make(map[string]interface{})
+	}
+	if len(wf.Params) == 0 {
+		for k, v := range inputs {
+			wf.Variables[k] = v
+		}
+		return errs
+	}
+
+	declared := make(map[string]bool)
+	for _, p := range wf.Params {
+		declared[p.Name] = true
+		path := "params." + p.Name
+		v, ok := inputs[p.Name]
+		if !ok || v == nil {
+			if p.Required {
+				errs = append(errs, ValidationError{Path: path, Message: "required param is missing", Severity: SEVERITY_ERROR})
+				continue
+			}
+			v = p.Default
+		}
+		if v == nil {
+			wf.Variables[p.Name] = nil // Declared, so JS can check it without a ReferenceError
+			continue
+		}
+		value, err := p.coerce(v)
+		if err != nil {
+			errs = append(errs, ValidationError{Path: path, Message: err.Error(), Severity: SEVERITY_ERROR})
+			continue
+		}
+		wf.Variables[p.Name] = value
+	}
+	for _, k := range sortedKeys(inputs) {
+		if !declared[k] {
+			errs = append(errs, ValidationError{Path: "params." + k, Message: "unknown param", Severity: SEVERITY_ERROR})
+		}
+	}
+	return errs
+}
+
+// Convert a value to the type of the param: "42" is fine for an integer, "abc" isn't
+func (p *ParamT) coerce(v interface{}) (interface{}, error) {
+	typeName, ok := TYPE_NAMES[p.Type]
+	if !ok {
+		typeName = TYPE_NAME_STRING
+	}
+	_, isObject := v.(map[string]interface{})
+	_, isArray := v.([]interface{})
+
+	if typeName == TYPE_NAME_JSON {
+		if isObject || isArray {
+			return v, nil
+		}
+		str := toString(v)
+		if _, isString := v.(string); isString && !IsJSON(str) {
+			return nil, errors.New("expected json, got " + strconv.Quote(str))
+		}
+		return json.RawMessage(str), nil
+	}
+	if isObject || isArray {
+		return nil, errors.New("expected " + p.Type + ", got an object or array")
+	}
+
+	vt := Var_Type{str: toString(v)}
+	findType(&vt)
+	switch typeName {
+	case TYPE_NAME_INTEGER:
+		if vt.typeName == TYPE_NAME_INTEGER {
+			return vt.integer, nil
+		}
+		// 3.0 from JSON is still an integer
+		if vt.typeName == TYPE_NAME_FLOAT && vt.float == float64(int64(vt.float)) {
+			return int64(vt.float), nil
+		}
+	case TYPE_NAME_FLOAT:
+		if vt.typeName == TYPE_NAME_INTEGER {
+			return float64(vt.integer), nil
+		}
+		if vt.typeName == TYPE_NAME_FLOAT {
+			return vt.float, nil
+		}
+	case TYPE_NAME_BOOLEAN:
+		if vt.typeName == TYPE_NAME_BOOLEAN {
+			return vt.boolean, nil
+		}
+	default:
+		return vt.str, nil
+	}
+	return nil, errors.New("expected " + p.Type + ", got " + strconv.Quote(vt.str))
+}
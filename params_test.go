@@ -0,0 +1,106 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParamCoerce(t *testing.T) {
+	for _, c := range []struct {
+		typ      string
+		in       interface{}
+		expected string // JSON of the coerced value, "" when it's an error
+	}{
+		{"integer", float64(42), `42`},
+		{"integer", "42", `42`},
+		{"integer", 3.0, `3`},
+		{"integer", 3.5, ``},
+		{"integer", "abc", ``},
+		{"integer", true, ``},
+		{"float", "1.5", `1.5`},
+		{"float", float64(2), `2`},
+		{"float", "x", ``},
+		{"boolean", true, `true`},
+		{"boolean", "false", `false`},
+		{"boolean", "yes", ``},
+		{"string", float64(7), `"7"`},
+		{"string", "7", `"7"`},
+		{"string", map[string]interface{}{"a": 1}, ``},
+		{"json", map[string]interface{}{"a": float64(1)}, `{"a":1}`},
+		{"json", []interface{}{"x"}, `["x"]`},
+		{"json", `{"b": 2}`, `{"b":2}`},
+		{"json", float64(5), `5`},
+		{"json", "not json", ``},
+		{"unknown", float64(1), `"1"`},
+	} {
+		p := &ParamT{Name: "p", Type: c.typ}
+		v, err := p.coerce(c.in)
+		if c.expected == "" {
+			if err == nil {
+				t.Errorf("%s %v: expected an error, got %v", c.typ, c.in, v)
+			}
+			continue
+		}
+		bs, _ := json.Marshal(v)
+		if err != nil || string(bs) != c.expected {
+			t.Errorf("%s %v: got %s %v, want %s", c.typ, c.in, bs, err, c.expected)
+		}
+	}
+}
+
+func TestApplyParams(t *testing.T) {
+	wf := WF{Params: []*ParamT{
+		{Name: "count", Type: "integer", Default: float64(1)},
+		{Name: "who", Type: "string", Required: true},
+		{Name: "opt", Type: "json"},
+	}}
+	errs := wf.ApplyParams(map[string]interface{}{"who": "me", "count": "5"})
+	bs, _ := json.Marshal(wf.Variables)
+	if len(errs) != 0 || string(bs) != `{"count":5,"opt":null,"who":"me"}` {
+		t.Error(errs, string(bs))
+	}
+
+	wf = WF{Params: wf.Params}
+	errs = wf.ApplyParams(map[string]interface{}{"count": "many", "extra": 1})
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	expected := []string{
+		`error: params.count: expected integer, got "many"`,
+		"error: params.who: required param is missing",
+		"error: params.extra: unknown param",
+	}
+	if len(got) != len(expected) {
+		t.Fatal(got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Error(got[i])
+		}
+	}
+
+	// Without params the inputs are variables as they are
+	wf = WF{}
+	wf.ApplyParams(map[string]interface{}{"a": "1"})
+	if wf.Variables["a"] != "1" {
+		t.Error(wf.Variables)
+	}
+}
+
+// Params are bound to JS with their type
+func TestParamsInRun(t *testing.T) {
+	wf, err := NEW_WF([]byte(`{"name":"P","params":[{"name":"n","type":"integer"},{"name":"f","type":"boolean","default":false}],
+		"steps":[{"name":"done","return":"({ next: n + 1, f: f, t: typeof n })"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := wf.ApplyParams(map[string]interface{}{"n": "41"}); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	bs, _ := json.Marshal(wf)
+	res, err := runTestWF(t, string(bs), nil)
+	if err != nil || res != `{"f":false,"next":42,"t":"number"}` {
+		t.Error(res, err)
+	}
+}
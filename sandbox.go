@@ -0,0 +1,103 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits for the JS of a workflow. Definitions come from many teams, so none of them must be able to hang or exhaust
+// a worker. An evaluation hitting a limit fails the run (see takeJSLimit), as it may not hit it on a replay
+type JSLimits struct {
+	Timeout   time.Duration // Per evaluation, the script is terminated after this
+	MaxHeap   uint64        // Bytes of heap of an engine, checked after each evaluation (v8go only)
+	MaxOutput int           // Bytes of the result of an evaluation
+	Globals   []string      // Globals left after the engine is set up, nil => JS_DEFAULT_GLOBALS
+}
+
+// Limits used by this process, set from the JS_TIMEOUT_MS, JS_MAX_HEAP_MB, JS_MAX_OUTPUT_KB and JS_GLOBALS env vars
+var JS_LIMITS = JSLimits{
+	Timeout:   time.Second,
+	MaxHeap:   64 << 20,
+	MaxOutput: 1 << 20,
+}
+
+// Standard built-ins without code generation (eval), shared memory and wasm
+var JS_DEFAULT_GLOBALS = []string{
+	"Object", "Function", "Array", "Number", "parseFloat", "parseInt", "Infinity", "NaN", "undefined", "Boolean",
+	"String", "Symbol", "Date", "Promise", "RegExp", "Error", "EvalError", "RangeError", "ReferenceError",
+	"SyntaxError", "TypeError", "URIError", "globalThis", "JSON", "Math", "Intl", "ArrayBuffer", "Uint8Array",
+	"Int8Array", "Uint16Array", "Int16Array", "Uint32Array", "Int32Array", "Float32Array", "Float64Array",
+	"Uint8ClampedArray", "DataView", "Map", "BigInt", "Set", "WeakMap", "WeakSet", "Proxy", "Reflect",
+	"decodeURI", "decodeURIComponent", "encodeURI", "encodeURIComponent", "escape", "unescape", "isFinite", "isNaN",
+}
+
+// Globals the engine itself needs, never removed
+var JS_ENGINE_GLOBALS = []string{"__now", "__random", "z"}
+
+var ERR_JS_TIMEOUT = errors.New("JS evaluation timed out")
+var ERR_JS_HEAP = errors.New("JS heap limit reached")
+
+// Delete every global that isn't allowed. Non configurable ones (e.g. NaN) can't be deleted and are harmless
+const RESTRICT_GLOBALS_JS = `
+(function (allowed) {
+	var global = (function () { return this; })();
+	Object.getOwnPropertyNames(global).forEach(function (name) {
+		if (allowed.indexOf(name) < 0) {
+			try { delete global[name]; } catch (e) {}
+		}
+	});
+})(%s);
+`
+
+// Names of the globals that aren't in the list, as JSON
+const VARIABLE_NAMES_JS = `
+(function (skip) {
+	var global = (function () { return this; })();
+	return JSON.stringify(Object.getOwnPropertyNames(global).filter(function (name) {
+		return skip.indexOf(name) < 0;
+	}));
+})(%s);
+`
+
+// Override the default limits from the env. 0 disables a limit
+func loadJSLimits() {
+	if ms, err := strconv.Atoi(os.Getenv("JS_TIMEOUT_MS")); err == nil {
+		JS_LIMITS.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	if mb, err := strconv.ParseUint(os.Getenv("JS_MAX_HEAP_MB"), 10, 64); err == nil {
+		JS_LIMITS.MaxHeap = mb << 20
+	}
+	if kb, err := strconv.Atoi(os.Getenv("JS_MAX_OUTPUT_KB")); err == nil {
+		JS_LIMITS.MaxOutput = kb << 10
+	}
+	if globals := os.Getenv("JS_GLOBALS"); globals != "" {
+		JS_LIMITS.Globals = strings.Split(strings.ReplaceAll(globals, " ", ""), ",")
+	}
+	log.Println("JS limits: ", JS_LIMITS.Timeout, JS_LIMITS.MaxHeap, JS_LIMITS.MaxOutput, JS_LIMITS.Globals)
+}
+
+func restrictGlobals(js JSEngine) error {
+	return js.Load(strings.Replace(RESTRICT_GLOBALS_JS, "%s", jsGlobals(), 1), "globals.js")
+}
+
+// JSON array of the globals left after restrictGlobals
+func jsGlobals() string {
+	globals := JS_LIMITS.Globals
+	if globals == nil {
+		globals = JS_DEFAULT_GLOBALS
+	}
+	bs, _ := json.Marshal(append(append([]string{}, globals...), JS_ENGINE_GLOBALS...))
+	return string(bs)
+}
+
+func checkOutput(limits JSLimits, val string) (string, error) {
+	if limits.MaxOutput > 0 && len(val) > limits.MaxOutput {
+		return "", errors.New("JS result of " + strconv.Itoa(len(val)) + " bytes is over the limit of " + strconv.Itoa(limits.MaxOutput))
+	}
+	return val, nil
+}
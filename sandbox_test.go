@@ -0,0 +1,109 @@
+package app
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testJSEngine(t *testing.T, name string, limits JSLimits) JSEngine {
+	t.Helper()
+	js, err := JS_ENGINES[name](JSHost{Now: func() float64 { return 0 }, Random: func() float64 { return 0 }}, limits)
+	if err != nil {
+		t.Fatal(name, err)
+	}
+	return js
+}
+
+func TestJSTimeout(t *testing.T) {
+	for name := range JS_ENGINES {
+		js := testJSEngine(t, name, JSLimits{Timeout: 50 * time.Millisecond})
+		if _, err := js.Eval("while (true) {}", "loop.js"); err != ERR_JS_TIMEOUT {
+			t.Error(name, err)
+		}
+		// The next evaluation isn't affected
+		if val, err := js.Eval("1 + 1", "after.js"); val != "2" || err != nil {
+			t.Error(name, val, err)
+		}
+		js.Close()
+	}
+}
+
+// v8go can't cap the heap, an evaluation leaving it over the limit fails once it's done
+func TestJSHeapLimit(t *testing.T) {
+	if _, ok := JS_ENGINES["v8go"]; !ok {
+		t.Skip("built without cgo")
+	}
+	fill := "var a = []; for (var i = 0; i < 1e6; i++) { a.push({ s: 'x' + i }); } a.length"
+	js := testJSEngine(t, "v8go", JSLimits{MaxHeap: 16 << 20})
+	defer js.Close()
+	if val, err := js.Eval("1 + 1", "small.js"); val != "2" || err != nil {
+		t.Error(val, err)
+	}
+	if _, err := js.Eval(fill, "heap.js"); err != ERR_JS_HEAP {
+		t.Fatal(err)
+	}
+	other := testJSEngine(t, "v8go", JSLimits{})
+	defer other.Close()
+	if val, err := other.Eval(fill, "big.js"); val != "1000000" || err != nil {
+		t.Error(val, err)
+	}
+}
+
+// The timer firing right as the script is done doesn't stop the next evaluation
+func TestJSTimeoutRace(t *testing.T) {
+	if _, ok := JS_ENGINES["v8go"]; !ok {
+		t.Skip("built without cgo")
+	}
+	js := testJSEngine(t, "v8go", JSLimits{Timeout: time.Millisecond})
+	defer js.Close()
+	for i := 0; i < 200; i++ {
+		js.Eval("var s = 0; for (var j = 0; j < 2e4; j++) { s += j; }", "race.js")
+		if val, err := js.Eval("1 + 1", "after.js"); err != nil && err != ERR_JS_TIMEOUT || err == nil && val != "2" {
+			t.Fatal(i, val, err)
+		}
+	}
+}
+
+// A limit fails the run right away, except doesn't catch it
+func TestJSLimitFailsTheRun(t *testing.T) {
+	timeout := JS_LIMITS.Timeout
+	JS_LIMITS.Timeout = 100 * time.Millisecond
+	defer func() { JS_LIMITS.Timeout = timeout }()
+	def := `{"name":"L","steps":[
+		{"name":"guarded","try":[{"name":"spin","assign":{"x":"(function () { while (true) {} })()"}},{"name":"never","call":"noops"}],
+		 "except":{"steps":[{"name":"caught","assign":{"y":"1"}}]}},
+		{"name":"done","return":"1"}]}`
+	for name := range JS_ENGINES {
+		_, err := runTestWFEngine(t, name, def, testMocks{
+			"noops": func(step *Step) (string, error) { return "", errors.New("the step after the limit ran") },
+		})
+		if err == nil || !strings.Contains(err.Error(), "step spin: JS evaluation timed out (type: "+ERROR_KIND_JS_LIMIT) {
+			t.Error(name, err)
+		}
+	}
+}
+
+func TestJSGlobalsRestricted(t *testing.T) {
+	def := `{"name":"G","steps":[{"name":"done","return":"[typeof eval, typeof WebAssembly, typeof JSON, typeof z]"}]}`
+	res, err := runTestWFEngine(t, "goja", def, nil)
+	if err != nil || res != `["undefined","undefined","object","undefined"]` {
+		t.Error(res, err)
+	}
+}
+
+// z.js still gets eval, which the definitions don't
+func TestMatch(t *testing.T) {
+	if _, ok := JS_ENGINES["v8go"]; !ok {
+		t.Skip("built without cgo")
+	}
+	def := `{"name":"M","steps":[
+		{"name":"init","assign":{"day":"'sat'","kind":"''"}},
+		{"name":"m","match":{"on":"day","conditions":["(x = 'sat') => { kind = 'weekend' }","(x) => { kind = 'weekday' }"]}},
+		{"name":"done","return":"[kind, typeof eval]"}]}`
+	res, err := runTestWFEngine(t, "v8go", def, nil)
+	if err != nil || res != `["weekend","undefined"]` {
+		t.Error(res, err)
+	}
+}
@@ -0,0 +1,306 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/robfig/cron"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Signals and query of ScheduleWorkflowMain
+const (
+	SIGNAL_SCHEDULE_PAUSE    = "pause"
+	SIGNAL_SCHEDULE_RESUME   = "resume"
+	SIGNAL_SCHEDULE_RUN_DONE = "run-done" // Sent by the runs, the payload is their workflow ID
+	QUERY_SCHEDULE           = "schedule"
+)
+
+// What to do when a run is due while the previous one is still running
+const (
+	OVERLAP_SKIP       = "skip"       // Don't start it
+	OVERLAP_BUFFER_ONE = "buffer_one" // Start it when the running one is done, at most one waits
+	OVERLAP_ALLOW_ALL  = "allow_all"  // Start it anyway
+)
+
+// What to do with the runs missed while no worker was up
+const (
+	CATCHUP_NONE = "none" // Skip them, only runs that are on time start
+	CATCHUP_ONE  = "one"  // One run for all of them
+	CATCHUP_ALL  = "all"  // Every missed run, within the catch up window
+)
+
+// Runs before the schedule continues as new, to keep its history short. The runs still running are carried over
+var SCHEDULE_RUNS_PER_HISTORY = 100
+
+// A late run within this is still on time
+const SCHEDULE_ON_TIME = time.Minute
+
+type (
+	// Start Definition with Variables (its params) on a cron expression (UTC, e.g. "0 9 * * 1-5" or "@hourly") or every Interval
+	// seconds. CatchupWindow (seconds, default a day) drops runs missed longer ago
+	ScheduleT struct {
+		Cron          string
+		Interval      int
+		Overlap       string
+		Catchup       string
+		CatchupWindow int
+		Variables     map[string]interface{}
+		Definition    WF
+		State         ScheduleState // Carried over when continuing as new
+	}
+
+	ScheduleState struct {
+		Paused   bool
+		Last     time.Time // Last due time that was handled
+		Next     time.Time `json:",omitempty"`
+		Runs     int
+		Skipped  int
+		Failed   int      // Due runs that couldn't start, e.g. their params are invalid
+		Running  []string // Workflow IDs, also of the runs started before continuing as new
+		Buffered bool
+	}
+)
+
+// Parse and check a schedule. The definition is checked like a run
+func NEW_SCHEDULE(json_bytes []byte) (ScheduleT, error) {
+	var s ScheduleT
+	err := json.Unmarshal(json_bytes, &s)
+	if err != nil {
+		return s, err
+	}
+	return s, s.Validate()
+}
+
+func (s *ScheduleT) Validate() error {
+	if (s.Cron == "") == (s.Interval <= 0) {
+		return errors.New("schedule needs either a cron or an interval")
+	}
+	if s.Cron != "" {
+		if _, err := cron.ParseStandard(s.Cron); err != nil {
+			return errors.New("invalid cron " + strconv.Quote(s.Cron) + ": " + err.Error())
+		}
+	}
+	if s.Overlap == "" {
+		s.Overlap = OVERLAP_SKIP
+	}
+	if !contains([]string{OVERLAP_SKIP, OVERLAP_BUFFER_ONE, OVERLAP_ALLOW_ALL}, s.Overlap) {
+		return errors.New("overlap must be skip, buffer_one or allow_all")
+	}
+	if s.Catchup == "" {
+		s.Catchup = CATCHUP_ONE
+	}
+	if !contains([]string{CATCHUP_NONE, CATCHUP_ONE, CATCHUP_ALL}, s.Catchup) {
+		return errors.New("catchup must be none, one or all")
+	}
+	if s.CatchupWindow <= 0 {
+		s.CatchupWindow = 24 * 60 * 60
+	}
+	if s.Variables == nil {
+		s.Variables = make(map[string]interface{})
+	}
+	return nil
+}
+
+// First due time after t
+func (s *ScheduleT) next(t time.Time) time.Time {
+	if s.Interval > 0 {
+		return t.Add(time.Duration(s.Interval) * time.Second)
+	}
+	schedule, _ := cron.ParseStandard(s.Cron) // Checked by Validate
+	return schedule.Next(t)
+}
+
+// Runs to start at now for the due times since the last one, following the catch up policy
+func (s *ScheduleT) due(now time.Time) []time.Time {
+	var due []time.Time
+	window := now.Add(-time.Duration(s.CatchupWindow) * time.Second)
+	for t := s.next(s.State.Last); !t.After(now); t = s.next(t) {
+		s.State.Last = t
+		if t.Before(window) {
+			continue
+		}
+		due = append(due, t)
+	}
+	if len(due) == 0 {
+		return due
+	}
+
+	latest := due[len(due)-1]
+	switch s.Catchup {
+	case CATCHUP_NONE:
+		if now.Sub(latest) > SCHEDULE_ON_TIME {
+			return nil
+		}
+		return due[len(due)-1:]
+	case CATCHUP_ONE:
+		return due[len(due)-1:]
+	}
+	return due
+}
+
+// Long running workflow that starts the runs of a schedule as child workflows. They are abandoned, so deleting the
+// schedule leaves them running. Runs signal their end, as the ones started before continuing as new can't be waited on
+func ScheduleWorkflowMain(ctx workflow.Context, s ScheduleT) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if s.State.Last.IsZero() {
+		s.State.Last = workflow.Now(ctx)
+	}
+	err := workflow.SetQueryHandler(ctx, QUERY_SCHEDULE, func() (ScheduleState, error) {
+		return s.State, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	pause := workflow.GetSignalChannel(ctx, SIGNAL_SCHEDULE_PAUSE)
+	resume := workflow.GetSignalChannel(ctx, SIGNAL_SCHEDULE_RESUME)
+	runDone := workflow.GetSignalChannel(ctx, SIGNAL_SCHEDULE_RUN_DONE)
+	running := make(map[string]workflow.Future) // nil for the runs carried over
+	for _, id := range s.State.Running {
+		running[id] = nil
+	}
+	runs := 0
+
+	start := func(t time.Time) {
+		id := workflow.GetInfo(ctx).WorkflowExecution.ID + "-" + t.UTC().Format("20060102T150405Z")
+		if _, ok := running[id]; ok {
+			return
+		}
+		wf := s.Definition
+		wf.Schedule = workflow.GetInfo(ctx).WorkflowExecution.ID
+		wf.Variables = make(map[string]interface{})
+		for k, v := range s.Definition.Variables {
+			wf.Variables[k] = v
+		}
+		if errs := wf.ApplyParams(s.Variables); errs.HasErrors() {
+			log.Println("SCHEDULE: run not started ", id, errs)
+			s.State.Failed++
+			return
+		}
+		cwo := workflow.ChildWorkflowOptions{WorkflowID: id, ParentClosePolicy: enumspb.PARENT_CLOSE_POLICY_ABANDON}
+		future := workflow.ExecuteChildWorkflow(workflow.WithChildOptions(ctx, cwo), WorkflowEngineMain, wf)
+		// Wait for the start only, the run is watched by the loop below
+		if err := future.GetChildWorkflowExecution().Get(ctx, nil); err != nil {
+			log.Println("SCHEDULE: run not started ", id, err)
+			s.State.Failed++
+			return
+		}
+		log.Println("SCHEDULE: started ", id)
+		running[id] = future
+		s.State.Runs++
+		runs++
+	}
+
+	// The future of a run and its signal both end it, the second one is ignored
+	done := func(id string, err error) {
+		if _, ok := running[id]; !ok {
+			return
+		}
+		log.Println("SCHEDULE: run done ", id, err)
+		delete(running, id)
+		if s.State.Buffered {
+			s.State.Buffered = false
+			start(workflow.Now(ctx))
+		}
+	}
+
+	for {
+		if runs >= SCHEDULE_RUNS_PER_HISTORY {
+			// Signals left in the channel would be lost
+			var id string
+			for runDone.ReceiveAsync(&id) {
+				done(id, nil)
+			}
+		}
+		s.State.Running = []string{}
+		for id := range running {
+			s.State.Running = append(s.State.Running, id)
+		}
+		sort.Strings(s.State.Running) // Map order is random, replays must add the futures in the same order
+		if runs >= SCHEDULE_RUNS_PER_HISTORY {
+			s.State.Next = time.Time{}
+			return workflow.NewContinueAsNewError(ctx, ScheduleWorkflowMain, s)
+		}
+
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(ctx.Done(), func(c workflow.ReceiveChannel, more bool) {})
+		selector.AddReceive(pause, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, nil)
+			s.State.Paused = true
+		})
+		selector.AddReceive(resume, func(c workflow.ReceiveChannel, more bool) {
+			c.Receive(ctx, nil)
+			s.State.Paused = false
+		})
+		selector.AddReceive(runDone, func(c workflow.ReceiveChannel, more bool) {
+			var id string
+			c.Receive(ctx, &id)
+			done(id, nil)
+		})
+		for _, id := range s.State.Running {
+			id := id
+			if running[id] == nil {
+				continue
+			}
+			selector.AddFuture(running[id], func(f workflow.Future) {
+				done(id, f.Get(ctx, nil))
+			})
+		}
+
+		tctx, cancel := workflow.WithCancel(ctx)
+		if s.State.Paused {
+			s.State.Next = time.Time{}
+		} else {
+			s.State.Next = s.next(s.State.Last)
+			wait := s.State.Next.Sub(workflow.Now(ctx))
+			if wait < 0 {
+				wait = 0
+			}
+			selector.AddFuture(workflow.NewTimer(tctx, wait), func(f workflow.Future) {
+				if f.Get(ctx, nil) != nil {
+					return
+				}
+				// The overlap policy is about the runs started before, the missed runs of a catch up all start
+				busy := len(running) > 0 && s.Overlap != OVERLAP_ALLOW_ALL
+				for _, t := range s.due(workflow.Now(ctx)) {
+					if !busy {
+						start(t)
+					} else if s.Overlap == OVERLAP_BUFFER_ONE {
+						s.State.Buffered = true
+					} else {
+						log.Println("SCHEDULE: skipped, previous run still running ", t)
+						s.State.Skipped++
+					}
+				}
+			})
+		}
+
+		selector.Select(ctx)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Paused schedules don't catch up on resume
+		if s.State.Paused {
+			s.State.Last = workflow.Now(ctx)
+		}
+	}
+}
+
+// Tell the schedule that started the run it's done. Its workflow ID stays the same when it continues as new
+func notifySchedule(ctx workflow.Context, schedule string) {
+	ctx, _ = workflow.NewDisconnectedContext(ctx)
+	id := workflow.GetInfo(ctx).WorkflowExecution.ID
+	err := workflow.SignalExternalWorkflow(ctx, schedule, "", SIGNAL_SCHEDULE_RUN_DONE, id).Get(ctx, nil)
+	if err != nil {
+		log.Println("SCHEDULE: couldn't signal ", schedule, err) // Deleted schedules are gone
+	}
+}
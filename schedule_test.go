@@ -0,0 +1,180 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Run a schedule whose last due time was `missed` intervals of a minute ago, for `d`. Runs take 10 minutes
+func runTestSchedule(t *testing.T, catchup string, overlap string, missed int, d time.Duration) ScheduleState {
+	t.Helper()
+	InitWorkflowGlobals()
+	wf, err := NEW_WF([]byte(`{"name":"S","steps":[{"name":"wait","call":"sleep","args":{"seconds":600}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(ScheduleWorkflowMain)
+	env.RegisterWorkflow(WorkflowEngineMain)
+
+	sched := ScheduleT{Interval: 60, Catchup: catchup, Overlap: overlap, Definition: wf}
+	sched.State.Last = env.Now().Add(-time.Duration(missed)*time.Minute - time.Second)
+	var state ScheduleState
+	env.RegisterDelayedCallback(func() {
+		val, err := env.QueryWorkflow(QUERY_SCHEDULE)
+		if err != nil {
+			t.Fatal(err)
+		}
+		val.Get(&state)
+		env.CancelWorkflow()
+	}, d)
+	env.ExecuteWorkflow(ScheduleWorkflowMain, sched)
+	return state
+}
+
+func TestScheduleCatchupAll(t *testing.T) {
+	// The 5 missed runs start although each overlaps the others, the run due a minute later is skipped
+	state := runTestSchedule(t, CATCHUP_ALL, OVERLAP_SKIP, 5, 90*time.Second)
+	if state.Runs != 5 || state.Skipped != 1 || len(state.Running) != 5 {
+		t.Errorf("%+v", state)
+	}
+}
+
+func TestScheduleCatchupOne(t *testing.T) {
+	state := runTestSchedule(t, CATCHUP_ONE, OVERLAP_SKIP, 5, 30*time.Second)
+	if state.Runs != 1 || state.Skipped != 0 {
+		t.Errorf("%+v", state)
+	}
+}
+
+func TestScheduleOverlapAllowAll(t *testing.T) {
+	state := runTestSchedule(t, CATCHUP_NONE, OVERLAP_ALLOW_ALL, 0, 150*time.Second)
+	if state.Runs != 2 || state.Skipped != 0 || len(state.Running) != 2 {
+		t.Errorf("%+v", state)
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	now := time.Date(2021, 5, 3, 9, 0, 30, 0, time.UTC)
+	s := ScheduleT{Cron: "0 * * * *", Catchup: CATCHUP_ALL, CatchupWindow: 3 * 60 * 60}
+	s.Validate()
+	s.State.Last = now.Add(-5 * time.Hour)
+	due := s.due(now)
+	// 5:00 and 6:00 are out of the window
+	if len(due) != 3 || due[0].Hour() != 7 || due[2].Hour() != 9 || !s.State.Last.Equal(due[2]) {
+		t.Error(due, s.State.Last)
+	}
+	s.Catchup = CATCHUP_NONE
+	s.State.Last = now.Add(-2 * time.Hour)
+	if due := s.due(now.Add(2 * time.Minute)); len(due) != 0 {
+		t.Error("late run started", due)
+	}
+}
+
+// allow_all with runs longer than the interval never has 0 runs running, it continues as new with them anyway
+func TestScheduleContinuesAsNewWhileRunning(t *testing.T) {
+	perHistory := SCHEDULE_RUNS_PER_HISTORY
+	SCHEDULE_RUNS_PER_HISTORY = 2
+	defer func() { SCHEDULE_RUNS_PER_HISTORY = perHistory }()
+	InitWorkflowGlobals()
+	wf, _ := NEW_WF([]byte(`{"name":"S","steps":[{"name":"wait","call":"sleep","args":{"seconds":600}}]}`))
+
+	s := &testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(ScheduleWorkflowMain)
+	env.RegisterWorkflow(WorkflowEngineMain)
+	env.ExecuteWorkflow(ScheduleWorkflowMain, ScheduleT{Interval: 60, Overlap: OVERLAP_ALLOW_ALL, Definition: wf})
+
+	var can *workflow.ContinueAsNewError
+	if !errors.As(env.GetWorkflowError(), &can) {
+		t.Fatal(env.GetWorkflowError())
+	}
+	var next ScheduleT
+	if err := converter.GetDefaultDataConverter().FromPayloads(can.Input, &next); err != nil {
+		t.Fatal(err)
+	}
+	if next.State.Runs != 2 || len(next.State.Running) != 2 {
+		t.Errorf("%+v", next.State)
+	}
+}
+
+// Runs carried over are running until they signal their end
+func TestScheduleCarriedRuns(t *testing.T) {
+	InitWorkflowGlobals()
+	wf, _ := NEW_WF([]byte(`{"name":"S","steps":[{"name":"wait","call":"sleep","args":{"seconds":600}}]}`))
+	s := &testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(ScheduleWorkflowMain)
+	env.RegisterWorkflow(WorkflowEngineMain)
+
+	sched := ScheduleT{Interval: 60, Catchup: CATCHUP_NONE, Definition: wf}
+	sched.State.Last = env.Now()
+	sched.State.Running = []string{"before"}
+	var state ScheduleState
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow(SIGNAL_SCHEDULE_RUN_DONE, "before")
+	}, 90*time.Second)
+	env.RegisterDelayedCallback(func() {
+		val, _ := env.QueryWorkflow(QUERY_SCHEDULE)
+		val.Get(&state)
+		env.CancelWorkflow()
+	}, 150*time.Second)
+	env.ExecuteWorkflow(ScheduleWorkflowMain, sched)
+
+	// Skipped at 60s while "before" was running, started at 120s
+	if state.Runs != 1 || state.Skipped != 1 || len(state.Running) != 1 || state.Running[0] == "before" {
+		t.Errorf("%+v", state)
+	}
+}
+
+// Runs started by a schedule signal it when they end
+func TestScheduleRunSignalsItsEnd(t *testing.T) {
+	InitWorkflowGlobals()
+	wf, _ := NEW_WF([]byte(`{"name":"S","steps":[{"name":"done","return":"1"}]}`))
+	s := &testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(WorkflowEngineMain)
+	parent := func(ctx workflow.Context) (string, error) {
+		wf.Schedule = workflow.GetInfo(ctx).WorkflowExecution.ID
+		cwo := workflow.ChildWorkflowOptions{WorkflowID: "run-1", ParentClosePolicy: enumspb.PARENT_CLOSE_POLICY_ABANDON}
+		workflow.ExecuteChildWorkflow(workflow.WithChildOptions(ctx, cwo), WorkflowEngineMain, wf)
+		var id string
+		workflow.GetSignalChannel(ctx, SIGNAL_SCHEDULE_RUN_DONE).Receive(ctx, &id)
+		return id, nil
+	}
+	env.RegisterWorkflow(parent)
+	env.ExecuteWorkflow(parent)
+	var id string
+	if err := env.GetWorkflowResult(&id); err != nil || id != "run-1" {
+		t.Error(id, err)
+	}
+}
+
+// A run whose params are invalid is counted, not only logged
+func TestScheduleInvalidParams(t *testing.T) {
+	InitWorkflowGlobals()
+	wf, _ := NEW_WF([]byte(`{"name":"S","params":[{"name":"n","type":"integer"}],"steps":[{"name":"done","return":"n"}]}`))
+	s := &testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(ScheduleWorkflowMain)
+	env.RegisterWorkflow(WorkflowEngineMain)
+
+	sched := ScheduleT{Interval: 60, Definition: wf, Variables: map[string]interface{}{"n": "many"}}
+	var state ScheduleState
+	env.RegisterDelayedCallback(func() {
+		val, _ := env.QueryWorkflow(QUERY_SCHEDULE)
+		val.Get(&state)
+		env.CancelWorkflow()
+	}, 150*time.Second)
+	env.ExecuteWorkflow(ScheduleWorkflowMain, sched)
+	if state.Runs != 0 || state.Failed != 2 {
+		t.Errorf("%+v", state)
+	}
+}
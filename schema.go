@@ -0,0 +1,134 @@
+package app
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"go.temporal.io/sdk/temporal"
+)
+
+// Types of an output schema, empty means anything
+var SCHEMA_TYPES = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// Subset of JSON schema for the value a workflow returns
+type SchemaT struct {
+	Type       string
+	Properties map[string]*SchemaT // Checked when present, other properties are allowed
+	Required   []string
+	Items      *SchemaT
+	Enum       []interface{}
+	Nullable   bool // null is fine too
+}
+
+// The return value of a run as JSON (null without a return step), checked against the output schema
+func (wf *WF) result() (interface{}, error) {
+	ret, _ := wf.Variables["return"].(string)
+	if ret == "" {
+		ret = "null"
+	}
+	if !IsJSON(ret) {
+		bs, _ := json.Marshal(ret)
+		ret = string(bs)
+	}
+	if wf.Output == nil {
+		return json.RawMessage(ret), nil
+	}
+
+	var value interface{}
+	json.Unmarshal([]byte(ret), &value)
+	if errs := wf.Output.check(value, "return"); len(errs) > 0 {
+		message := "return value doesn't match the output schema: " + errs[0]
+		return nil, temporal.NewNonRetryableApplicationError(message, ERROR_KIND_OUTPUT, nil, errs)
+	}
+	return json.RawMessage(ret), nil
+}
+
+// Every mismatch of a decoded JSON value, with the path to it
+func (s *SchemaT) check(value interface{}, path string) []string {
+	if s == nil {
+		return nil
+	}
+	if value == nil && s.Nullable {
+		return nil
+	}
+	if s.Type != "" && jsonType(value) != s.Type && !(s.Type == "number" && jsonType(value) == "integer") {
+		return []string{path + ": expected " + s.Type + ", got " + jsonType(value)}
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(normalizeJSON(e), value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			bs, _ := json.Marshal(value)
+			return []string{path + ": " + string(bs) + " isn't one of the enum values"}
+		}
+	}
+
+	var errs []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs = append(errs, path+"."+name+": required property is missing")
+			}
+		}
+		for _, name := range s.propertyNames() {
+			if pv, ok := v[name]; ok {
+				errs = append(errs, s.Properties[name].check(pv, path+"."+name)...)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			errs = append(errs, s.Items.check(item, path+"["+strconv.Itoa(i)+"]")...)
+		}
+	}
+	return errs
+}
+
+func (s *SchemaT) propertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name of the schema type of a decoded JSON value. Whole numbers are integers
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// Enum values from a Go definition (e.g. ints) compare like decoded JSON
+func normalizeJSON(value interface{}) interface{} {
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var v interface{}
+	json.Unmarshal(bs, &v)
+	return v
+}
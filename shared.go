@@ -1,11 +1,26 @@
 package app
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
 	"regexp"
+	"sort"
+
+	"go.temporal.io/sdk/client"
 )
 
 const WorkflowEngineTaskQueue = "WORKFLOW_ENGINE_TASK_QUEUE"
 
+// Temporal client options of the worker, the runtime server and wfctl. HOSTPORT env var, default localhost:7233
+func CLIENT_OPTIONS() client.Options {
+	option := client.Options{}
+	if os.Getenv("HOSTPORT") != "" {
+		option = client.Options{HostPort: os.Getenv("HOSTPORT")}
+	}
+	return option
+}
+
 func UnEscapeStr(str string) string {
 	m, _ := regexp.MatchString(`^"\\"([^\\]+)\\""$`, str)
 	if m {
@@ -26,3 +41,35 @@ func RemoveQuote(str string) string {
 	}
 	return str
 }
+
+// Query/form values can be numbers or booleans in the json, send them as their plain text
+func toString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case nil:
+		return ""
+	case map[string]interface{}, []interface{}:
+		bs, _ := json.Marshal(t)
+		return string(bs)
+	}
+	return fmt.Sprint(v)
+}
+
+func contains(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
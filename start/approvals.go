@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"workflow_engine/app"
+)
+
+// Approve or reject a pending approval step. Body { "decision": "approve" | "reject", "comment": "...", "by": "..." },
+// the decision can also be given as ?decision= for forms. There's no GET, link previews and mail scanners would decide
+// the approval
+func DecideApproval(c *gin.Context) {
+	token := c.Param("token")
+	var req struct {
+		Decision string `json:"decision"`
+		Comment  string `json:"comment"`
+		By       string `json:"by"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status": "fail",
+				"error":  err.Error(),
+			})
+			return
+		}
+	}
+	if req.Decision == "" {
+		req.Decision = c.Query("decision")
+	}
+	if req.Decision != "approve" && req.Decision != "reject" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  "decision must be approve or reject",
+		})
+		return
+	}
+
+	id, err := app.APPROVAL_WORKFLOW_ID(token)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "fail",
+			"error":  "Unknown approval",
+		})
+		return
+	}
+
+	// The token must be pending in the run, so unknown or decided tokens don't leave signals nobody waits for
+	var state app.RunState
+	val, err := temporalClient.QueryWorkflow(context.Background(), id, "", app.QUERY_STATE)
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	if err := val.Get(&state); err != nil {
+		temporalError(c, err)
+		return
+	}
+	var approval *app.ApprovalRecord
+	hash := app.APPROVAL_TOKEN_HASH(token)
+	for _, a := range state.Approvals {
+		if a.TokenHash == hash {
+			approval = a
+		}
+	}
+	if approval == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "fail",
+			"error":  "Unknown approval",
+		})
+		return
+	}
+	if approval.Status != app.APPROVAL_PENDING {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":   "fail",
+			"error":    "Approval is already " + approval.Status,
+			"approval": approval.Status,
+		})
+		return
+	}
+
+	decision := app.ApprovalDecision{Approve: req.Decision == "approve", Comment: req.Comment, By: req.By}
+	err = temporalClient.SignalWorkflow(context.Background(), id, "", app.SIGNAL_APPROVAL+hash, decision)
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"workflowId": id,
+		"step":       approval.Step,
+		"decision":   req.Decision,
+	})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pborman/uuid"
+	"go.temporal.io/sdk/client"
+
+	"workflow_engine/app"
+)
+
+// Latest version of every stored definition
+func ListDefinitions(c *gin.Context) {
+	list, err := definitionStore.List()
+	if err != nil {
+		definitionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "success",
+		"definitions": list,
+	})
+}
+
+// Store the body as the next version of :name. It's validated like a run, YAML is stored as JSON
+func CreateDefinition(c *gin.Context) {
+	name := c.Param("name")
+	body, positions, ok := requestBody(c, "Empty workflow")
+	if !ok {
+		return
+	}
+	_, err := app.NEW_WF(body)
+	var errs app.ValidationErrors
+	if errors.As(err, &errs) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  "Invalid workflow",
+			"errors": positions.Locate(errs, ""),
+		})
+		return
+	}
+
+	d, err := definitionStore.Put(name, body)
+	if err != nil {
+		definitionError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"name":    d.Name,
+		"version": d.Version,
+	})
+}
+
+// The definition of :name, the latest version that isn't deprecated unless ?version=
+func GetDefinition(c *gin.Context) {
+	version, ok := versionParam(c, c.Query("version"))
+	if !ok {
+		return
+	}
+	d, err := definitionStore.Get(c.Param("name"), version)
+	if err != nil {
+		definitionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"definition": d,
+	})
+}
+
+func GetDefinitionVersions(c *gin.Context) {
+	versions, err := definitionStore.Versions(c.Param("name"))
+	if err != nil {
+		definitionError(c, err)
+		return
+	}
+	for i := range versions {
+		versions[i].Definition = nil
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"versions": versions,
+	})
+}
+
+// Control flow of :name, ?version= and ?format= (dot or mermaid)
+func GetDefinitionGraph(c *gin.Context) {
+	version, ok := versionParam(c, c.Query("version"))
+	if !ok {
+		return
+	}
+	d, err := definitionStore.Get(c.Param("name"), version)
+	if err != nil {
+		definitionError(c, err)
+		return
+	}
+	wf, err := app.NEW_WF(d.Definition)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "fail",
+			"error":  err.Error(),
+		})
+		return
+	}
+	writeGraph(c, wf)
+}
+
+// Deprecated versions are skipped when no version is given and can't be run anymore. Running workflows aren't affected
+func DeprecateDefinition(c *gin.Context) {
+	version, ok := versionParam(c, c.Param("version"))
+	if !ok {
+		return
+	}
+	d, err := definitionStore.Deprecate(c.Param("name"), version)
+	if err != nil {
+		definitionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"name":       d.Name,
+		"version":    d.Version,
+		"deprecated": d.Deprecated,
+	})
+}
+
+// Run a stored definition, body { "params": { ... } }. The run gets the whole definition, so it keeps the version
+// it started with. ?version= and ?wait= like /api/v1/run
+func RunDefinition(c *gin.Context) {
+	name := c.Param("name")
+	version, ok := versionParam(c, c.Query("version"))
+	if !ok {
+		return
+	}
+	var req struct {
+		Params map[string]interface{} `json:"params"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status": "fail",
+				"error":  err.Error(),
+			})
+			return
+		}
+	}
+
+	d, err := definitionStore.Get(name, version)
+	if err != nil {
+		definitionError(c, err)
+		return
+	}
+	if d.Deprecated {
+		c.JSON(http.StatusConflict, gin.H{
+			"status": "fail",
+			"error":  "Version " + strconv.Itoa(d.Version) + " of " + name + " is deprecated",
+		})
+		return
+	}
+
+	wf, err := app.NEW_WF(d.Definition)
+	if err == nil {
+		err = wf.ResolveChildren(definitionStore)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": "fail",
+			"error":  err.Error(),
+		})
+		return
+	}
+	wf.Name = name
+	wf.Version = d.Version
+	if errs := wf.ApplyParams(req.Params); errs.HasErrors() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  "Invalid params",
+			"errors": errs,
+		})
+		return
+	}
+
+	options := client.StartWorkflowOptions{
+		ID:        name + "-" + uuid.New(),
+		TaskQueue: app.WorkflowEngineTaskQueue,
+		Memo:      map[string]interface{}{"definition": name, "version": d.Version},
+	}
+	startWorkflow(c, options, app.WorkflowEngineMain, wf)
+}
+
+// 0 when empty. Writes the 400 itself
+func versionParam(c *gin.Context, str string) (int, bool) {
+	if str == "" {
+		return 0, true
+	}
+	version, err := strconv.Atoi(str)
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  "Invalid version " + strconv.Quote(str),
+		})
+		return 0, false
+	}
+	return version, true
+}
+
+// 404 for unknown definitions, 500 for anything else
+func definitionError(c *gin.Context, err error) {
+	if errors.Is(err, app.ERR_DEFINITION_NOT_FOUND) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "fail",
+			"error":  "Definition not found",
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"status": "fail",
+		"error":  err.Error(),
+	})
+}
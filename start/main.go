@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
 	"os"
 
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -16,6 +19,10 @@ import (
 )
 
 var temporalClient client.Client
+var definitionStore app.DefinitionStore
+
+// How long ?wait=true waits by default
+const DEFAULT_RUN_TIMEOUT = 30 * time.Second
 
 func main() {
 	envNotFount := godotenv.Load()
@@ -23,10 +30,7 @@ func main() {
 		log.Println(".env not found")
 	}
 
-	option := client.Options{}
-	if os.Getenv("HOSTPORT") != "" {
-		option = client.Options{HostPort: os.Getenv("HOSTPORT")}
-	}
+	option := app.CLIENT_OPTIONS()
 
 	// Create the client object just once per process
 	c, err := client.NewClient(option)
@@ -37,11 +41,40 @@ func main() {
 
 	defer c.Close()
 
+	store, err := app.NEW_DEFINITION_STORE(os.Getenv("DEFINITION_STORE"), os.Getenv("DEFINITION_STORE_PATH"))
+	if err != nil {
+		log.Fatalln("unable to open the definition store", err)
+	}
+	definitionStore = store
+	defer store.Close()
+
 	// WEB SERVER
 	PORT := 3007
 	r := gin.Default()
 
 	r.POST("/api/v1/run", RunWorkflow)
+	r.POST("/api/v1/graph", GraphWorkflow)
+	r.GET("/api/v1/workflows/:id", GetWorkflowStatus)
+	r.GET("/api/v1/workflows/:id/result", GetWorkflowResult)
+	r.GET("/api/v1/workflows/:id/history", GetWorkflowHistory)
+	r.POST("/api/v1/workflows/:id/cancel", CancelWorkflow)
+	r.POST("/api/v1/workflows/:id/terminate", TerminateWorkflow)
+	r.POST("/api/v1/workflows/:id/signal/:name", SignalWorkflow)
+	r.POST("/api/v1/workflows/:id/reset", ResetWorkflow)
+	r.POST("/api/v1/approvals/:token", DecideApproval)
+	r.GET("/api/v1/definitions", ListDefinitions)
+	r.POST("/api/v1/definitions/:name", CreateDefinition)
+	r.GET("/api/v1/definitions/:name", GetDefinition)
+	r.GET("/api/v1/definitions/:name/versions", GetDefinitionVersions)
+	r.GET("/api/v1/definitions/:name/graph", GetDefinitionGraph)
+	r.POST("/api/v1/definitions/:name/versions/:version/deprecate", DeprecateDefinition)
+	r.POST("/api/v1/definitions/:name/run", RunDefinition)
+	r.GET("/api/v1/schedules", ListSchedules)
+	r.POST("/api/v1/schedules", CreateSchedule)
+	r.GET("/api/v1/schedules/:id", GetSchedule)
+	r.POST("/api/v1/schedules/:id/pause", PauseSchedule)
+	r.POST("/api/v1/schedules/:id/resume", ResumeSchedule)
+	r.DELETE("/api/v1/schedules/:id", DeleteSchedule)
 	addr := ":" + strconv.Itoa(PORT)
 
 	r.Run(addr) // listen and serve on 0.0.0.0:3007 (for windows "localhost:3007")
@@ -53,42 +86,155 @@ func RunWorkflow(c *gin.Context) {
 		TaskQueue: app.WorkflowEngineTaskQueue,
 	}
 
-	body, err := c.GetRawData()
-	if err != nil || len(body) < 2 {
-		c.JSON(400, gin.H{
-			"status": "fail",
-			"error":  "Empty workflow",
-		})
+	body, positions, ok := requestBody(c, "Empty workflow")
+	if !ok {
 		return
 	}
-	wf, err := app.NEW_WF(body)
+	// Statement format definitions can be run by their own interpreter instead of being converted to WF steps
+	var workflowFunc interface{} = app.WorkflowEngineMain
+	var workflowArg interface{}
+	if c.Query("dsl") == "statement" {
+		dslWorkflow, err := app.NEW_STATEMENT_WORKFLOW(body)
+		root := dslWorkflow.Root
+		if err == nil && root.Activity == nil && root.Sequence == nil && root.Parallel == nil {
+			err = errors.New("statement workflow has no root")
+		}
+		if err != nil {
+			c.JSON(400, gin.H{
+				"status": "fail",
+				"error":  "Invalid statement workflow: " + err.Error(),
+			})
+			return
+		}
+		workflowFunc = app.StatementWorkflowMain
+		workflowArg = dslWorkflow
+	} else {
+		// { "definition": { ... }, "params": { ... } } runs a definition with params, otherwise the body is the definition
+		var req struct {
+			Definition json.RawMessage
+			Params     map[string]interface{}
+		}
+		json.Unmarshal(body, &req)
+		prefix := ""
+		if len(req.Definition) > 0 {
+			body = req.Definition
+			prefix = "definition."
+		}
+
+		wf, err := app.NEW_WF(body)
+		var errs app.ValidationErrors
+		if errors.As(err, &errs) {
+			c.JSON(400, gin.H{
+				"status": "fail",
+				"error":  "Invalid workflow",
+				"errors": positions.Locate(errs, prefix),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{
+				"status": "fail",
+				"error":  err.Error(),
+			})
+			return
+		}
+		errs = wf.ApplyParams(req.Params)
+		if errs.HasErrors() {
+			c.JSON(400, gin.H{
+				"status": "fail",
+				"error":  "Invalid params",
+				"errors": positions.Locate(errs, ""),
+			})
+			return
+		}
+		err = wf.ResolveChildren(definitionStore)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"status": "fail",
+				"error":  err.Error(),
+			})
+			return
+		}
+		workflowArg = wf
+	}
+
+	startWorkflow(c, options, workflowFunc, workflowArg)
+}
+
+// Start the run, with ?wait=true wait for the result
+func startWorkflow(c *gin.Context, options client.StartWorkflowOptions, workflowFunc interface{}, workflowArg interface{}) {
+	var err error
+	timeout := DEFAULT_RUN_TIMEOUT
+	if c.Query("timeout") != "" {
+		timeout, err = time.ParseDuration(c.Query("timeout"))
+		if err != nil {
+			c.JSON(400, gin.H{
+				"status": "fail",
+				"error":  "Invalid timeout: " + err.Error(),
+			})
+			return
+		}
+	}
+	if timeout > MAX_RESULT_WAIT {
+		timeout = MAX_RESULT_WAIT
+	}
+
+	we, err := temporalClient.ExecuteWorkflow(context.Background(), options, workflowFunc, workflowArg)
 	if err != nil {
+		log.Println("Unable to execute workflow", err)
 		c.JSON(500, gin.H{
-			"status": "fail",
-			"error":  err.Error(),
+			"status":     "fail",
+			"error":      err.Error(),
+			"workflowId": options.ID,
 		})
 		return
 	}
+	log.Println("Started workflow", "WorkflowID", we.GetID(), "RunID", we.GetRunID())
 
-	we, err := temporalClient.ExecuteWorkflow(context.Background(), options, app.WorkflowEngineMain, wf)
-	if err != nil {
-		log.Println("Unable to execute workflow", err)
-	} else {
-		log.Println("Started workflow", "WorkflowID", we.GetID(), "RunID", we.GetRunID())
+	if c.Query("wait") == "true" {
+		waitForResult(c, we, timeout)
+		return
 	}
 
-	if err != nil {
-		c.JSON(500, gin.H{
-			"status":     "fail",
-			"error":      err,
+	c.JSON(200, gin.H{
+		"status":     "success",
+		"workflowId": we.GetID(),
+		"runId":      we.GetRunID(),
+	})
+}
+
+// Synchronous run: 200 with the result, 422 when the workflow failed and 504 when it's still running after ?timeout=
+// (default 30s), with the IDs to poll /result
+func waitForResult(c *gin.Context, we client.WorkflowRun, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var result interface{}
+	err := we.Get(ctx, &result)
+	if err != nil && ctx.Err() != nil {
+		c.JSON(504, gin.H{
+			"status":     "running",
+			"error":      "Workflow still running after " + timeout.String(),
 			"workflowId": we.GetID(),
 			"runId":      we.GetRunID(),
 		})
-	} else {
-		c.JSON(200, gin.H{
-			"status":     "success",
+		return
+	}
+	if err != nil {
+		c.JSON(422, gin.H{
+			"status":     "fail",
+			"error":      err.Error(),
+			"errors":     workflowErrors(err),
 			"workflowId": we.GetID(),
 			"runId":      we.GetRunID(),
 		})
+		return
 	}
+
+	c.JSON(200, gin.H{
+		"status":     "success",
+		"result":     result,
+		"workflowId": we.GetID(),
+		"runId":      we.GetRunID(),
+	})
 }
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pborman/uuid"
+	filterpb "go.temporal.io/api/filter/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+
+	"workflow_engine/app"
+)
+
+// Workflow ID of a schedule is the prefix + the schedule ID
+const SCHEDULE_PREFIX = "schedule-"
+
+// Create a schedule. Body: the schedule fields (cron or interval, overlap, catchup, catchupWindow, variables), the
+// definition inline or the name (and version) of a stored one and an optional id
+func CreateSchedule(c *gin.Context) {
+	body, positions, ok := requestBody(c, "Empty schedule")
+	if !ok {
+		return
+	}
+	var req struct {
+		Id         string
+		Name       string
+		Version    int
+		Definition json.RawMessage
+	}
+	json.Unmarshal(body, &req)
+	sched, err := app.NEW_SCHEDULE(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	definition := []byte(req.Definition)
+	version := 0
+	if req.Name != "" {
+		d, err := definitionStore.Get(req.Name, req.Version)
+		if err != nil {
+			definitionError(c, err)
+			return
+		}
+		definition = d.Definition
+		version = d.Version
+	}
+	if len(definition) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  "Schedule needs a definition or the name of a stored one",
+		})
+		return
+	}
+
+	wf, err := app.NEW_WF(definition)
+	var errs app.ValidationErrors
+	if err == nil {
+		errs = wf.ApplyParams(sched.Variables)
+		if !errs.HasErrors() {
+			errs = wf.Validate() // Checks the names of the schedule variables too
+		}
+	} else {
+		errors.As(err, &errs)
+	}
+	if errs.HasErrors() {
+		if req.Name != "" {
+			positions = nil // Errors of a stored definition aren't in the body
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  "Invalid workflow",
+			"errors": positions.Locate(errs, "definition."),
+		})
+		return
+	}
+	err = wf.ResolveChildren(definitionStore)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  err.Error(),
+		})
+		return
+	}
+	// The schedule variables are given to every run instead
+	for k := range sched.Variables {
+		delete(wf.Variables, k)
+	}
+	for _, p := range wf.Params {
+		delete(wf.Variables, p.Name)
+	}
+	if req.Name != "" {
+		wf.Name = req.Name
+		wf.Version = version
+	}
+	sched.Definition = wf
+
+	id := req.Id
+	if id == "" {
+		id = uuid.New()
+	}
+	options := client.StartWorkflowOptions{
+		ID:        SCHEDULE_PREFIX + id,
+		TaskQueue: app.WorkflowEngineTaskQueue,
+		// The client returns the running schedule otherwise
+		WorkflowExecutionErrorWhenAlreadyStarted: true,
+	}
+	we, err := temporalClient.ExecuteWorkflow(context.Background(), options, app.ScheduleWorkflowMain, sched)
+	var started *serviceerror.WorkflowExecutionAlreadyStarted
+	if errors.As(err, &started) {
+		c.JSON(http.StatusConflict, gin.H{
+			"status": "fail",
+			"error":  "Schedule " + id + " already exists",
+		})
+		return
+	}
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"status":     "success",
+		"id":         id,
+		"workflowId": we.GetID(),
+		"runId":      we.GetRunID(),
+	})
+}
+
+// Schedules that aren't deleted
+func ListSchedules(c *gin.Context) {
+	res, err := temporalClient.ListOpenWorkflow(context.Background(), &workflowservice.ListOpenWorkflowExecutionsRequest{
+		Namespace: client.DefaultNamespace,
+		Filters: &workflowservice.ListOpenWorkflowExecutionsRequest_TypeFilter{
+			TypeFilter: &filterpb.WorkflowTypeFilter{Name: "ScheduleWorkflowMain"},
+		},
+	})
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	schedules := []gin.H{}
+	for _, info := range res.GetExecutions() {
+		schedules = append(schedules, gin.H{
+			"id":        strings.TrimPrefix(info.GetExecution().GetWorkflowId(), SCHEDULE_PREFIX),
+			"startTime": info.GetStartTime(),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"schedules": schedules,
+	})
+}
+
+// Paused, last and next due time, number of runs and the runs still running
+func GetSchedule(c *gin.Context) {
+	id := c.Param("id")
+	val, err := temporalClient.QueryWorkflow(context.Background(), SCHEDULE_PREFIX+id, "", app.QUERY_SCHEDULE)
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	var state app.ScheduleState
+	if err := val.Get(&state); err != nil {
+		temporalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"id":       id,
+		"schedule": state,
+	})
+}
+
+// Runs missed while paused are skipped
+func PauseSchedule(c *gin.Context) {
+	signalSchedule(c, app.SIGNAL_SCHEDULE_PAUSE)
+}
+
+func ResumeSchedule(c *gin.Context) {
+	signalSchedule(c, app.SIGNAL_SCHEDULE_RESUME)
+}
+
+// Stop the schedule, runs that already started keep running
+func DeleteSchedule(c *gin.Context) {
+	id := c.Param("id")
+	err := temporalClient.CancelWorkflow(context.Background(), SCHEDULE_PREFIX+id, "")
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"id":     id,
+	})
+}
+
+func signalSchedule(c *gin.Context, signal string) {
+	id := c.Param("id")
+	err := temporalClient.SignalWorkflow(context.Background(), SCHEDULE_PREFIX+id, "", signal, nil)
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"id":     id,
+	})
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pborman/uuid"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/temporal"
+
+	"workflow_engine/app"
+)
+
+// Longest a request can block on /result?wait=
+const MAX_RESULT_WAIT = 5 * time.Minute
+
+// An activity of a step as found in the history
+type activityRecord struct {
+	Step      string      `json:"step"`
+	Activity  string      `json:"activity"`
+	Args      interface{} `json:"args"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Status    string      `json:"status"`
+	Attempt   int32       `json:"attempt,omitempty"`
+	Scheduled *time.Time  `json:"scheduled"`
+	Closed    *time.Time  `json:"closed,omitempty"`
+}
+
+// Status, start/close time and the steps currently running
+func GetWorkflowStatus(c *gin.Context) {
+	id := c.Param("id")
+	status, err := app.WORKFLOW_STATUS(context.Background(), temporalClient, id, c.Query("runId"))
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+
+	res := gin.H(status)
+	res["status"] = "success"
+	c.JSON(http.StatusOK, res)
+}
+
+// Return value of the workflow. 202 while it's running, unless ?wait=30s blocks until it's done (or the wait is over)
+func GetWorkflowResult(c *gin.Context) {
+	id := c.Param("id")
+	runID := c.Query("runId")
+
+	wait := time.Duration(0)
+	if c.Query("wait") != "" {
+		d, err := time.ParseDuration(c.Query("wait"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status": "fail",
+				"error":  "Invalid wait: " + err.Error(),
+			})
+			return
+		}
+		wait = d
+	}
+	if wait > MAX_RESULT_WAIT {
+		wait = MAX_RESULT_WAIT
+	}
+
+	desc, err := temporalClient.DescribeWorkflowExecution(context.Background(), id, runID)
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	running := desc.GetWorkflowExecutionInfo().GetStatus() == enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING
+	if running && wait == 0 {
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":     "running",
+			"workflowId": id,
+			"runId":      desc.GetWorkflowExecutionInfo().GetExecution().GetRunId(),
+		})
+		return
+	}
+
+	ctx := context.Background()
+	if running {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, wait)
+		defer cancel()
+	}
+
+	we := temporalClient.GetWorkflow(context.Background(), id, runID)
+	var result interface{}
+	err = we.Get(ctx, &result)
+	if err != nil && ctx.Err() != nil {
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":     "running",
+			"workflowId": id,
+			"runId":      we.GetRunID(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"status":     "fail",
+			"error":      err.Error(),
+			"errors":     workflowErrors(err),
+			"workflowId": id,
+			"runId":      we.GetRunID(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"result":     result,
+		"workflowId": id,
+		"runId":      we.GetRunID(),
+	})
+}
+
+// Inputs and outputs of every step. The steps come from the state query (needs a worker), the activities straight
+// from the temporal history
+func GetWorkflowHistory(c *gin.Context) {
+	id := c.Param("id")
+	runID := c.Query("runId")
+
+	dc := converter.GetDefaultDataConverter()
+	var activities []*activityRecord
+	scheduled := make(map[int64]*activityRecord)
+	var input, output interface{}
+	failure := ""
+
+	iter := temporalClient.GetWorkflowHistory(context.Background(), id, runID, false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	for iter.HasNext() {
+		event, err := iter.Next()
+		if err != nil {
+			temporalError(c, err)
+			return
+		}
+
+		switch event.GetEventType() {
+		case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_STARTED:
+			var wf app.WF
+			if dc.FromPayloads(event.GetWorkflowExecutionStartedEventAttributes().GetInput(), &wf) == nil {
+				input = wf.Variables
+			}
+		case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_COMPLETED:
+			dc.FromPayloads(event.GetWorkflowExecutionCompletedEventAttributes().GetResult(), &output)
+		case enumspb.EVENT_TYPE_WORKFLOW_EXECUTION_FAILED:
+			failure = event.GetWorkflowExecutionFailedEventAttributes().GetFailure().GetMessage()
+		case enumspb.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED:
+			attrs := event.GetActivityTaskScheduledEventAttributes()
+			var step app.Step
+			dc.FromPayloads(attrs.GetInput(), &step)
+			record := &activityRecord{
+				Step:      step.Name,
+				Activity:  attrs.GetActivityType().GetName(),
+				Args:      step.Args,
+				Status:    "Scheduled",
+				Scheduled: event.GetEventTime(),
+			}
+			scheduled[event.GetEventId()] = record
+			activities = append(activities, record)
+		case enumspb.EVENT_TYPE_ACTIVITY_TASK_STARTED:
+			attrs := event.GetActivityTaskStartedEventAttributes()
+			if record, ok := scheduled[attrs.GetScheduledEventId()]; ok {
+				record.Status = "Started"
+				record.Attempt = attrs.GetAttempt()
+			}
+		case enumspb.EVENT_TYPE_ACTIVITY_TASK_COMPLETED:
+			attrs := event.GetActivityTaskCompletedEventAttributes()
+			if record, ok := scheduled[attrs.GetScheduledEventId()]; ok {
+				record.Status = "Completed"
+				record.Closed = event.GetEventTime()
+				dc.FromPayloads(attrs.GetResult(), &record.Result)
+			}
+		case enumspb.EVENT_TYPE_ACTIVITY_TASK_FAILED:
+			attrs := event.GetActivityTaskFailedEventAttributes()
+			if record, ok := scheduled[attrs.GetScheduledEventId()]; ok {
+				record.Status = "Failed"
+				record.Closed = event.GetEventTime()
+				record.Error = attrs.GetFailure().GetMessage()
+			}
+		case enumspb.EVENT_TYPE_ACTIVITY_TASK_TIMED_OUT:
+			attrs := event.GetActivityTaskTimedOutEventAttributes()
+			if record, ok := scheduled[attrs.GetScheduledEventId()]; ok {
+				record.Status = "TimedOut"
+				record.Closed = event.GetEventTime()
+				record.Error = attrs.GetFailure().GetMessage()
+			}
+		case enumspb.EVENT_TYPE_ACTIVITY_TASK_CANCELED:
+			attrs := event.GetActivityTaskCanceledEventAttributes()
+			if record, ok := scheduled[attrs.GetScheduledEventId()]; ok {
+				record.Status = "Canceled"
+				record.Closed = event.GetEventTime()
+			}
+		}
+	}
+
+	// Notify steps of approvals send the tokens, anyone can read the history
+	for _, a := range activities {
+		a.Args = app.REDACT_APPROVAL_TOKENS(id, a.Args)
+		a.Result = app.REDACT_APPROVAL_TOKENS(id, a.Result)
+	}
+	res := gin.H{
+		"status":     "success",
+		"workflowId": id,
+		"input":      input,
+		"activities": activities,
+		"result":     app.REDACT_APPROVAL_TOKENS(id, output),
+	}
+	if failure != "" {
+		res["error"] = failure
+	}
+
+	var state app.RunState
+	val, err := temporalClient.QueryWorkflow(context.Background(), id, runID, app.QUERY_STATE)
+	if err == nil && val.Get(&state) == nil {
+		res["steps"] = state.Steps
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Request cancellation. The workflow runs its finally steps and ends as canceled
+func CancelWorkflow(c *gin.Context) {
+	id := c.Param("id")
+	err := temporalClient.CancelWorkflow(context.Background(), id, c.Query("runId"))
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"workflowId": id,
+	})
+}
+
+// Kill a run right away, finally steps don't run. Body { "reason": "..." }
+func TerminateWorkflow(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status": "fail",
+				"error":  err.Error(),
+			})
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = "Terminated from the runtime server"
+	}
+
+	err := temporalClient.TerminateWorkflow(context.Background(), id, c.Query("runId"), req.Reason)
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"workflowId": id,
+		"reason":     req.Reason,
+	})
+}
+
+// Send the JSON body as the payload of the signal :name
+func SignalWorkflow(c *gin.Context) {
+	id := c.Param("id")
+	name := c.Param("name")
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	var payload interface{}
+	if len(body) > 0 {
+		if !app.IsJSON(string(body)) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status": "fail",
+				"error":  "Signal payload must be JSON",
+			})
+			return
+		}
+		payload = json.RawMessage(body)
+	}
+
+	err = temporalClient.SignalWorkflow(context.Background(), id, c.Query("runId"), name, payload)
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"workflowId": id,
+		"signal":     name,
+	})
+}
+
+// Reset the run to the workflow task that scheduled the activity of a step, i.e. run it again from that step.
+// Body { "step": "name", "reason": "..." }. Steps without an activity aren't in the history and can't be reset to
+func ResetWorkflow(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		Step   string `json:"step"`
+		Reason string `json:"reason"`
+	}
+	err := c.ShouldBindJSON(&req)
+	if err == nil && req.Step == "" {
+		err = errors.New("step is required")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  err.Error(),
+		})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "Reset to step " + req.Step
+	}
+
+	desc, err := temporalClient.DescribeWorkflowExecution(context.Background(), id, c.Query("runId"))
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	runID := desc.GetWorkflowExecutionInfo().GetExecution().GetRunId()
+
+	dc := converter.GetDefaultDataConverter()
+	eventID := int64(0)
+	iter := temporalClient.GetWorkflowHistory(context.Background(), id, runID, false, enumspb.HISTORY_EVENT_FILTER_TYPE_ALL_EVENT)
+	for iter.HasNext() && eventID == 0 {
+		event, err := iter.Next()
+		if err != nil {
+			temporalError(c, err)
+			return
+		}
+		if event.GetEventType() != enumspb.EVENT_TYPE_ACTIVITY_TASK_SCHEDULED {
+			continue
+		}
+		attrs := event.GetActivityTaskScheduledEventAttributes()
+		var step app.Step
+		if dc.FromPayloads(attrs.GetInput(), &step) == nil && step.Name == req.Step {
+			eventID = attrs.GetWorkflowTaskCompletedEventId()
+		}
+	}
+	if eventID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  "No activity of step " + req.Step + " in the history",
+		})
+		return
+	}
+
+	res, err := temporalClient.ResetWorkflowExecution(context.Background(), &workflowservice.ResetWorkflowExecutionRequest{
+		Namespace:                 client.DefaultNamespace,
+		WorkflowExecution:         &commonpb.WorkflowExecution{WorkflowId: id, RunId: runID},
+		Reason:                    req.Reason,
+		WorkflowTaskFinishEventId: eventID,
+		RequestId:                 uuid.New(),
+	})
+	if err != nil {
+		temporalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"workflowId": id,
+		"runId":      res.GetRunId(),
+		"step":       req.Step,
+	})
+}
+
+// 404 for unknown workflows, 500 for anything else
+func temporalError(c *gin.Context, err error) {
+	var notFound *serviceerror.NotFound
+	if errors.As(err, &notFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": "fail",
+			"error":  "Workflow not found",
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"status": "fail",
+		"error":  err.Error(),
+	})
+}
+
+// Control flow of the definition in the body, ?format=dot (default) or mermaid
+func GraphWorkflow(c *gin.Context) {
+	body, positions, ok := requestBody(c, "Empty workflow")
+	if !ok {
+		return
+	}
+	wf, err := app.NEW_WF(body)
+	var errs app.ValidationErrors
+	if errors.As(err, &errs) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  "Invalid workflow",
+			"errors": positions.Locate(errs, ""),
+		})
+		return
+	}
+	writeGraph(c, wf)
+}
+
+// The body as JSON, YAML bodies (Content-Type application/yaml...) are converted with the positions of their values
+// for the errors. Writes the 400 itself
+func requestBody(c *gin.Context, empty string) ([]byte, app.YAMLPositions, bool) {
+	body, err := c.GetRawData()
+	if err != nil || len(bytes.TrimSpace(body)) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  empty,
+		})
+		return nil, nil, false
+	}
+	if !app.IsYAMLContentType(c.ContentType()) {
+		return body, nil, true
+	}
+	body, positions, err := app.YAML_TO_JSON(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  err.Error(),
+		})
+		return nil, nil, false
+	}
+	return body, positions, true
+}
+
+// The graph as text, graphviz or mermaid source
+func writeGraph(c *gin.Context, wf app.WF) {
+	format := c.DefaultQuery("format", "dot")
+	out, err := wf.Graph().Format(format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": "fail",
+			"error":  err.Error(),
+		})
+		return
+	}
+	contentType := "text/plain; charset=utf-8"
+	if format == "dot" {
+		contentType = "text/vnd.graphviz; charset=utf-8"
+	}
+	c.Data(http.StatusOK, contentType, []byte(out))
+}
+
+// Structured errors of a failed workflow. JS errors and output schema mismatches are one entry each
+func workflowErrors(err error) []gin.H {
+	var appErr *temporal.ApplicationError
+	if !errors.As(err, &appErr) {
+		return []gin.H{{"kind": app.ERROR_KIND_WORKFLOW, "message": err.Error()}}
+	}
+
+	var details []interface{}
+	kind := appErr.Type()
+	if (kind == app.ERROR_KIND_JS || kind == app.ERROR_KIND_OUTPUT) && appErr.HasDetails() && appErr.Details(&details) == nil {
+		var errs []gin.H
+		for _, d := range details {
+			errs = append(errs, gin.H{"kind": kind, "message": d})
+		}
+		return errs
+	}
+	return []gin.H{{"kind": appErr.Type(), "message": appErr.Error()}}
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Query answered by WorkflowEngineMain with its RunState
+const QUERY_STATE = "state"
+
+type (
+	// Progress of a run. Current has more than one step while parallel branches or for iterations run
+	RunState struct {
+		Current   []string
+		Steps     []StepRecord
+		Approvals []*ApprovalRecord
+	}
+
+	// Inputs and outputs of an executed step
+	StepRecord struct {
+		Name    string
+		Call    string
+		Args    map[string]interface{}
+		Result  string `json:",omitempty"`
+		Return  string `json:",omitempty"`
+		Error   string `json:",omitempty"`
+		Started int64  // unix ms, workflow time
+		Ended   int64
+	}
+
+	stateKey struct{}
+)
+
+// Register the query and keep the state in the ctx for wf.run
+func withRunState(ctx workflow.Context) (workflow.Context, error) {
+	state := &RunState{Current: []string{}, Steps: []StepRecord{}, Approvals: []*ApprovalRecord{}}
+	err := workflow.SetQueryHandler(ctx, QUERY_STATE, func() (*RunState, error) {
+		return state, nil
+	})
+	return workflow.WithValue(ctx, stateKey{}, state), err
+}
+
+func stepStarted(ctx workflow.Context, s *Step) {
+	state, ok := ctx.Value(stateKey{}).(*RunState)
+	if !ok {
+		return
+	}
+	state.Current = append(state.Current, s.Name)
+}
+
+func stepEnded(ctx workflow.Context, s *Step, started int64, err error) {
+	state, ok := ctx.Value(stateKey{}).(*RunState)
+	if !ok {
+		return
+	}
+	for i, name := range state.Current {
+		if name == s.Name {
+			state.Current = append(state.Current[:i], state.Current[i+1:]...)
+			break
+		}
+	}
+
+	// Notify steps of an approval have its token in their args and maybe results, the state is shown to everyone
+	id := workflow.GetInfo(ctx).WorkflowExecution.ID
+	record := StepRecord{Name: s.Name, Call: s.Call, Args: make(map[string]interface{}), Started: started, Ended: nowMs(ctx)}
+	for k, v := range s.Args {
+		record.Args[k] = REDACT_APPROVAL_TOKENS(id, v)
+	}
+	if s.Result != "" {
+		result, _ := s.Variables[s.Result].(string)
+		record.Result, _ = REDACT_APPROVAL_TOKENS(id, result).(string)
+	}
+	ret, _ := s.Variables["return"].(string)
+	record.Return, _ = REDACT_APPROVAL_TOKENS(id, ret).(string)
+	if err != nil {
+		record.Error = err.Error()
+	}
+	state.Steps = append(state.Steps, record)
+}
+
+func nowMs(ctx workflow.Context) int64 {
+	return workflow.Now(ctx).UnixNano() / 1e6
+}
+
+// Status of a run as shown by GET /api/v1/workflows/:id and wfctl status. The current steps of a running one need a
+// worker to answer the query, so they're left out when it fails
+func WORKFLOW_STATUS(ctx context.Context, c client.Client, id string, runID string) (map[string]interface{}, error) {
+	desc, err := c.DescribeWorkflowExecution(ctx, id, runID)
+	if err != nil {
+		return nil, err
+	}
+	info := desc.GetWorkflowExecutionInfo()
+	var state *RunState
+	if info.GetStatus() == enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING {
+		val, err := c.QueryWorkflow(ctx, id, info.GetExecution().GetRunId(), QUERY_STATE)
+		if err == nil && val.Get(&state) != nil {
+			state = nil
+		}
+	}
+	return workflowStatus(info, state), nil
+}
+
+func workflowStatus(info *workflowpb.WorkflowExecutionInfo, state *RunState) map[string]interface{} {
+	status := map[string]interface{}{
+		"workflowId":     info.GetExecution().GetWorkflowId(),
+		"runId":          info.GetExecution().GetRunId(),
+		"workflowType":   info.GetType().GetName(),
+		"workflowStatus": info.GetStatus().String(),
+		"startTime":      info.GetStartTime(),
+		"closeTime":      info.GetCloseTime(),
+		"historyLength":  info.GetHistoryLength(),
+	}
+	if state != nil {
+		status["currentSteps"] = state.Current
+	}
+	return status
+}
@@ -0,0 +1,33 @@
+package app
+
+import (
+	"testing"
+
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+)
+
+func TestWorkflowStatus(t *testing.T) {
+	info := &workflowpb.WorkflowExecutionInfo{
+		Execution:     &commonpb.WorkflowExecution{WorkflowId: "order-1", RunId: "run-1"},
+		Type:          &commonpb.WorkflowType{Name: "WorkflowEngineMain"},
+		Status:        enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING,
+		HistoryLength: 12,
+	}
+	status := workflowStatus(info, &RunState{Current: []string{"a", "b"}})
+	if status["workflowId"] != "order-1" || status["runId"] != "run-1" || status["workflowType"] != "WorkflowEngineMain" ||
+		status["workflowStatus"] != "Running" || status["historyLength"] != int64(12) {
+		t.Error(status)
+	}
+	if current, _ := status["currentSteps"].([]string); len(current) != 2 {
+		t.Error(status["currentSteps"])
+	}
+
+	// Without a state, e.g. when no worker answered the query
+	info.Status = enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED
+	status = workflowStatus(info, nil)
+	if _, ok := status["currentSteps"]; ok || status["workflowStatus"] != "Completed" {
+		t.Error(status)
+	}
+}
@@ -0,0 +1,244 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/robertkrimen/otto"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Names of the activities in the Statement format => call of a WF step
+var STATEMENT_CALLS = map[string]string{
+	"CallHttp":    "http.get",
+	"HttpRequest": "http.request",
+	"NopActivity": "noops",
+	"Sleep":       "sleep",
+}
+
+// Constructor function for the older Workflow/Statement format
+func NEW_STATEMENT_WORKFLOW(json_bytes []byte) (Workflow, error) {
+	var dslWorkflow Workflow
+	err := json.Unmarshal(json_bytes, &dslWorkflow)
+	if dslWorkflow.Variables == nil {
+		dslWorkflow.Variables = make(map[string]string)
+	}
+	return dslWorkflow, err
+}
+
+// Main workflow func for the Statement format. Runs the statement tree as is, with otto for the return expressions
+func StatementWorkflowMain(ctx workflow.Context, dslWorkflow Workflow) (interface{}, error) {
+	ao := workflow.ActivityOptions{
+		StartToCloseTimeout: 10 * time.Second,
+	}
+	ctx = workflow.WithActivityOptions(ctx, ao)
+	logger := workflow.GetLogger(ctx)
+
+	bindings := make(map[string]string)
+	jsvm := otto.New()
+	for k, v := range dslWorkflow.Variables {
+		bindings[k] = v
+		jsvm.Set(k, v)
+	}
+
+	err := dslWorkflow.Root.execute(ctx, jsvm, bindings)
+	if err != nil {
+		logger.Error("Statement workflow failed.", "Error", err)
+		return "", err
+	}
+	logger.Info("Statement workflow completed.")
+
+	// JSON like the result of WorkflowEngineMain, JSON.stringify(undefined) isn't
+	ret := bindings["return"]
+	if ret == "" || !IsJSON(ret) {
+		ret = "null"
+	}
+	return json.RawMessage(ret), nil
+}
+
+func (b *Statement) execute(ctx workflow.Context, jsvm *otto.Otto, bindings map[string]string) error {
+	if b.Parallel != nil {
+		return b.Parallel.execute(ctx, jsvm, bindings)
+	}
+	if b.Sequence != nil {
+		return b.Sequence.execute(ctx, jsvm, bindings)
+	}
+	if b.Activity != nil {
+		return b.Activity.execute(ctx, jsvm, bindings)
+	}
+	return nil
+}
+
+func (s Sequence) execute(ctx workflow.Context, jsvm *otto.Otto, bindings map[string]string) error {
+	for _, a := range s.Elements {
+		err := a.execute(ctx, jsvm, bindings)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// All the branches are started, and waited for even when one of them fails
+func (p Parallel) execute(ctx workflow.Context, jsvm *otto.Otto, bindings map[string]string) error {
+	var futures []workflow.Future
+	for _, s := range p.Branches {
+		futures = append(futures, executeAsync(s, ctx, jsvm, bindings))
+	}
+
+	var firstErr error
+	for _, f := range futures {
+		err := f.Get(ctx, nil)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Arguments are names of bindings, or literal values when there is no such binding
+func (a ActivityInvocation) execute(ctx workflow.Context, jsvm *otto.Otto, bindings map[string]string) error {
+	inputs := makeInput(a.Arguments, bindings)
+
+	step := &Step{Name: a.Name, Call: STATEMENT_CALLS[a.Name], Args: make(map[string]interface{})}
+	step.Args["arguments"] = inputs
+	if len(inputs) > 0 {
+		step.Args["url"] = inputs[0]
+		step.Args["seconds"] = inputs[0]
+	}
+
+	var result string
+	err := workflow.ExecuteActivity(ctx, a.Name, step).Get(ctx, &result)
+	if err != nil {
+		return err
+	}
+
+	if a.Result != "" {
+		bindings[a.Result] = result
+		if IsJSON(result) {
+			_, err = jsvm.Run(a.Result + " = " + result + ";")
+		} else {
+			err = jsvm.Set(a.Result, result)
+		}
+		if err != nil {
+			log.Println("STATEMENT RESULT: ", a.Result, err)
+		}
+	}
+
+	if a.Return != "" {
+		val, err := jsvm.Run("JSON.stringify(" + a.Return + ")")
+		if err != nil {
+			log.Println("STATEMENT RETURN: ", a.Return, err)
+			return err
+		}
+		bindings["return"] = val.String()
+	}
+	return nil
+}
+
+// Convert the Statement format into WF steps. Parallel statements become parallel steps with one branch per statement
+// and returns are kept in a variable which is returned at the end, as a return step would end the WF right away.
+// The steps aren't validated nor expanded into activities yet, NEW_WF does that
+func (w Workflow) ToWF() WF {
+	c := &statementConverter{known: make(map[string]bool)}
+	wf := WF{Name: "Statement", Variables: make(map[string]interface{})}
+
+	if len(w.Variables) > 0 {
+		init := &Step{Name: "variables"}
+		keys := make([]string, 0, len(w.Variables))
+		for k, v := range w.Variables {
+			wf.Variables[k] = v
+			keys = append(keys, k)
+			c.known[k] = true
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			bs, _ := json.Marshal(w.Variables[k])
+			init.Assign = append(init.Assign, AssignmentT{Name: k, Value: string(bs)}) // JS string literal
+		}
+		wf.Steps = append(wf.Steps, init)
+	}
+
+	wf.Steps = append(wf.Steps, c.convert(&w.Root)...)
+	if c.hasReturn {
+		wf.Steps = append(wf.Steps, &Step{Name: "return", Return: STATEMENT_RETURN})
+	}
+	return wf
+}
+
+const STATEMENT_RETURN = "_return"
+
+type statementConverter struct {
+	count     int
+	known     map[string]bool // variables and results seen so far
+	hasReturn bool
+}
+
+// Step names must be unique, so every step gets a running number
+func (c *statementConverter) name(prefix string) string {
+	c.count++
+	return prefix + "_" + strconv.Itoa(c.count)
+}
+
+func (c *statementConverter) convert(b *Statement) []*Step {
+	var steps []*Step
+	if b.Sequence != nil {
+		for _, e := range b.Sequence.Elements {
+			steps = append(steps, c.convert(e)...)
+		}
+	}
+
+	if b.Parallel != nil {
+		p := &Step{Name: c.name("parallel"), Parallel: &ParallelT{}}
+		for i, e := range b.Parallel.Branches {
+			p.Parallel.Branches = append(p.Parallel.Branches, &BranchT{
+				Name:  "branch_" + strconv.Itoa(i),
+				Steps: c.convert(e),
+			})
+		}
+		steps = append(steps, p)
+	}
+
+	if b.Activity != nil {
+		a := b.Activity
+		call, ok := STATEMENT_CALLS[a.Name]
+		if !ok {
+			call = a.Name
+		}
+		s := &Step{Name: c.name(a.Name), Call: call, Args: make(map[string]interface{}), Result: a.Result}
+
+		var arguments []interface{}
+		for _, arg := range a.Arguments {
+			if c.known[arg] {
+				arguments = append(arguments, "${"+arg+"}")
+			} else {
+				arguments = append(arguments, arg)
+			}
+		}
+		s.Args["arguments"] = arguments
+		if len(arguments) > 0 {
+			s.Args["url"] = arguments[0]
+			s.Args["seconds"] = arguments[0]
+		}
+		if a.Result != "" {
+			c.known[a.Result] = true
+		}
+		steps = append(steps, s)
+
+		if a.Return != "" {
+			c.hasReturn = true
+			steps = append(steps, &Step{
+				Name:   s.Name + "_return",
+				Assign: AssignT{{Name: STATEMENT_RETURN, Value: a.Return}},
+			})
+		}
+	}
+	return steps
+}
+
+func (b *Statement) empty() bool {
+	return b.Activity == nil && b.Sequence == nil && b.Parallel == nil
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.temporal.io/sdk/testsuite"
+)
+
+const testStatement = `{"variables":{"who":"World"},"root":{"sequence":{"elements":[
+	{"activity":{"name":"NopActivity","arguments":["who"],"result":"r"}},
+	{"activity":{"name":"NopActivity","return":"r + ' ' + who"}}
+]}}}`
+
+func TestStatementConverted(t *testing.T) {
+	InitWorkflowGlobals()
+	wf, err := NEW_WF([]byte(testStatement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// variables, 2 activities, the assign of the return and the return step, each expanded once
+	if len(wf.Activities) != 5 {
+		t.Error(len(wf.Activities))
+	}
+	res, err := runTestWF(t, testStatement, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != `"Result_NopActivity World"` {
+		t.Error(res)
+	}
+}
+
+// ?dsl=statement runs it as is, the result is a JSON value like the one of WorkflowEngineMain
+func TestStatementWorkflowMain(t *testing.T) {
+	var w Workflow
+	if err := json.Unmarshal([]byte(testStatement), &w); err != nil {
+		t.Fatal(err)
+	}
+	s := &testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(StatementWorkflowMain)
+	env.RegisterActivity((&ActivityType{}).NopActivity)
+	env.ExecuteWorkflow(StatementWorkflowMain, w)
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	var res interface{}
+	if err := env.GetWorkflowResult(&res); err != nil || res != "Result_NopActivity World" {
+		t.Error(res, err)
+	}
+}
+
+// Converted definitions are validated like the others, NEW_WF and VALIDATE_WF agree
+func TestStatementValidated(t *testing.T) {
+	def := []byte(`{"variables":{"bad-name":"x"},"root":{"activity":{"name":"Frobnicate"}}}`)
+	_, err := NEW_WF(def)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatal(err)
+	}
+	expected := VALIDATE_WF(def)
+	if len(errs) != len(expected) || len(errs) != 3 {
+		t.Fatal(errs, expected)
+	}
+	for i, e := range errs {
+		if e != expected[i] {
+			t.Error(e, expected[i])
+		}
+	}
+	if !strings.Contains(errs.Error(), `unknown call "Frobnicate"`) || !strings.Contains(errs.Error(), `"bad-name" is not a valid variable name`) {
+		t.Error(errs)
+	}
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// One bucket per definition name, keyed by the big endian version so that the keys sort by version
+type boltStore struct {
+	db *bolt.DB
+}
+
+// Embedded store in a single file, default ./definitions.db. Only one process can open it
+func NEW_BOLT_STORE(path string) (DefinitionStore, error) {
+	if path == "" {
+		path = "./definitions.db"
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func versionKey(version int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(version))
+	return key
+}
+
+func (s *boltStore) Put(name string, definition []byte) (DefinitionT, error) {
+	var d DefinitionT
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		d = DefinitionT{Name: name, Version: int(seq), Definition: definition, Created: time.Now()}
+		bs, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		return b.Put(versionKey(d.Version), bs)
+	})
+	return d, err
+}
+
+func (s *boltStore) Get(name string, version int) (DefinitionT, error) {
+	versions, err := s.Versions(name)
+	if err != nil {
+		return DefinitionT{}, err
+	}
+	return latestDefinition(versions, version)
+}
+
+func (s *boltStore) Versions(name string) ([]DefinitionT, error) {
+	var versions []DefinitionT
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(name))
+		if b == nil {
+			return ERR_DEFINITION_NOT_FOUND
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var d DefinitionT
+			err := json.Unmarshal(v, &d)
+			versions = append(versions, d)
+			return err
+		})
+	})
+	return versions, err
+}
+
+func (s *boltStore) List() ([]DefinitionT, error) {
+	list := []DefinitionT{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			_, v := b.Cursor().Last()
+			if v == nil {
+				return nil
+			}
+			var d DefinitionT
+			err := json.Unmarshal(v, &d)
+			d.Definition = nil
+			list = append(list, d)
+			return err
+		})
+	})
+	return list, err
+}
+
+func (s *boltStore) Deprecate(name string, version int) (DefinitionT, error) {
+	var d DefinitionT
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(name))
+		if b == nil {
+			return ERR_DEFINITION_NOT_FOUND
+		}
+		v := b.Get(versionKey(version))
+		if v == nil {
+			return ERR_DEFINITION_NOT_FOUND
+		}
+		err := json.Unmarshal(v, &d)
+		if err != nil {
+			return err
+		}
+		d.Deprecated = true
+		bs, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		return b.Put(versionKey(version), bs)
+	})
+	return d, err
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
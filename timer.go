@@ -0,0 +1,96 @@
+package app
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Change ID of sleep steps becoming durable timers. Runs started before still replay with the Sleep activity
+const VERSION_SLEEP_TIMER = "sleep-timer"
+
+var R_ISO_DURATION = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)W)?(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// "PT1H30M", "P2D", "P1W" or a Go duration like "1h30m". Years and months aren't supported, their length varies
+func PARSE_DURATION(str string) (time.Duration, error) {
+	str = strings.TrimSpace(str)
+	up := strings.ToUpper(str)
+	m := R_ISO_DURATION.FindStringSubmatch(up)
+	if m == nil || up == "P" || strings.HasSuffix(up, "T") {
+		d, err := time.ParseDuration(str)
+		if err != nil {
+			return 0, errors.New("invalid duration " + strconv.Quote(str) + ", expected ISO-8601 like PT1H30M")
+		}
+		return d, nil
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	d := time.Duration(0)
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		n, _ := strconv.ParseFloat(m[i+1], 64)
+		d += time.Duration(n * float64(unit))
+	}
+	return d, nil
+}
+
+// RFC 3339 timestamp or unix ms, e.g. the result of an expression like ${Date.now() + 3600000}
+func PARSE_TIME(str string) (time.Time, error) {
+	str = strings.TrimSpace(str)
+	if ms, err := strconv.ParseFloat(str, 64); err == nil {
+		return time.Unix(0, int64(ms)*int64(time.Millisecond)), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		return t, errors.New("invalid time " + strconv.Quote(str) + ", expected RFC 3339 or unix ms")
+	}
+	return t, nil
+}
+
+// How long a sleep step waits: args.seconds, args.duration or until args.until (0 when it's past)
+func (s *Step) sleepDuration(ctx workflow.Context) (time.Duration, error) {
+	if v, ok := s.Args["until"]; ok {
+		until, err := PARSE_TIME(toString(v))
+		if err != nil {
+			return 0, err
+		}
+		d := until.Sub(workflow.Now(ctx))
+		if d < 0 {
+			d = 0
+		}
+		return d, nil
+	}
+	if v, ok := s.Args["duration"]; ok {
+		return PARSE_DURATION(toString(v))
+	}
+	if v, ok := s.Args["seconds"]; ok {
+		seconds, err := strconv.ParseFloat(toString(v), 64)
+		if err != nil {
+			return 0, errors.New("invalid seconds " + strconv.Quote(toString(v)) + ", must be a number")
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return 0, errors.New("sleep needs seconds, duration or until")
+}
+
+// Durable timer, no worker is busy while it runs so it can last days
+func (s *Step) sleep(ctx workflow.Context) error {
+	d, err := s.sleepDuration(ctx)
+	if err != nil {
+		return temporal.NewNonRetryableApplicationError(err.Error(), ERROR_KIND_ARGS, nil)
+	}
+	if d <= 0 {
+		log.Println("SLEEP: ", s.Name, "already due")
+		return nil
+	}
+	log.Println("SLEEP: ", s.Name, d)
+	return workflow.NewTimer(ctx, d).Get(ctx, nil)
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+func TestParseDuration(t *testing.T) {
+	for _, c := range []struct {
+		str      string
+		expected time.Duration
+		valid    bool
+	}{
+		{"PT1H30M", 90 * time.Minute, true},
+		{"P2D", 48 * time.Hour, true},
+		{"P1W", 7 * 24 * time.Hour, true},
+		{"P1DT12H", 36 * time.Hour, true},
+		{"pt0.5s", 500 * time.Millisecond, true},
+		{"90s", 90 * time.Second, true},
+		{" 1h30m ", 90 * time.Minute, true},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"P1Y", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	} {
+		d, err := PARSE_DURATION(c.str)
+		if (err == nil) != c.valid || d != c.expected {
+			t.Errorf("%q: got %v %v, want %v", c.str, d, err, c.expected)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	expected := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	for _, str := range []string{"2021-03-04T05:06:07Z", "2021-03-04T06:06:07+01:00", "1614834367000", " 1614834367000 "} {
+		tm, err := PARSE_TIME(str)
+		if err != nil || !tm.Equal(expected) {
+			t.Errorf("%q: got %v %v", str, tm, err)
+		}
+	}
+	for _, str := range []string{"2021-03-04", "tomorrow", ""} {
+		if _, err := PARSE_TIME(str); err == nil {
+			t.Error(str)
+		}
+	}
+}
+
+func TestSleepDuration(t *testing.T) {
+	now := time.Date(2021, 3, 4, 5, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		args     map[string]interface{}
+		expected time.Duration
+		valid    bool
+	}{
+		{map[string]interface{}{"seconds": 1.5}, 1500 * time.Millisecond, true},
+		{map[string]interface{}{"seconds": "5"}, 5 * time.Second, true},
+		{map[string]interface{}{"duration": "PT2H"}, 2 * time.Hour, true},
+		{map[string]interface{}{"until": "2021-03-04T06:00:00Z"}, time.Hour, true},
+		{map[string]interface{}{"until": float64(now.Add(time.Minute).UnixNano() / 1e6)}, time.Minute, true},
+		// Already due, no negative timer
+		{map[string]interface{}{"until": "2021-03-04T04:00:00Z"}, 0, true},
+		{map[string]interface{}{"seconds": "five"}, 0, false},
+		{map[string]interface{}{"until": "later"}, 0, false},
+		{map[string]interface{}{}, 0, false},
+	} {
+		s := &testsuite.WorkflowTestSuite{}
+		env := s.NewTestWorkflowEnvironment()
+		env.SetStartTime(now)
+		step := &Step{Name: "s", Call: "sleep", Args: c.args}
+		var errMessage string
+		env.ExecuteWorkflow(func(ctx workflow.Context) (time.Duration, error) {
+			d, err := step.sleepDuration(ctx)
+			if err != nil {
+				errMessage = err.Error()
+			}
+			return d, nil
+		})
+		var d time.Duration
+		env.GetWorkflowResult(&d)
+		if (errMessage == "") != c.valid || d != c.expected {
+			t.Errorf("%v: got %v %q, want %v", c.args, d, errMessage, c.expected)
+		}
+	}
+}
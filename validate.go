@@ -0,0 +1,465 @@
+package app
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+)
+
+type (
+	// A problem in a definition. Path is the JSON path of the offending value e.g. steps[2].children[0].next
+	ValidationError struct {
+		Path     string `json:"path"`
+		Message  string `json:"message"`
+		Severity string `json:"severity"`
+		Line     int    `json:"line,omitempty"` // In the YAML source, 0 for JSON
+		Column   int    `json:"column,omitempty"`
+	}
+
+	ValidationErrors []ValidationError
+
+	// Steps that can jump to each other with next/switch, i.e. the activities of one (sub) workflow
+	validationScope struct {
+		names map[string]string // step name => path
+	}
+
+	validator struct {
+		errs ValidationErrors
+	}
+)
+
+// A JS variable, optionally a property path: user, user.name
+var R_JS_VAR, _ = regexp.Compile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)*$`)
+
+var JS_RESERVED = []string{
+	"break", "case", "catch", "class", "const", "continue", "debugger", "default", "delete", "do", "else", "export",
+	"extends", "false", "finally", "for", "function", "if", "import", "in", "instanceof", "let", "new", "null",
+	"return", "super", "switch", "this", "throw", "true", "try", "typeof", "var", "void", "while", "with", "yield",
+}
+
+func (e ValidationError) Error() string {
+	where := ""
+	if e.Line > 0 {
+		where = "line " + strconv.Itoa(e.Line) + ", column " + strconv.Itoa(e.Column) + ": "
+	}
+	if e.Path == "" {
+		return e.Severity + ": " + where + e.Message
+	}
+	return e.Severity + ": " + where + e.Path + ": " + e.Message
+}
+
+func (errs ValidationErrors) Error() string {
+	var lines []string
+	for _, e := range errs {
+		lines = append(lines, e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Warnings alone don't make a definition invalid
+func (errs ValidationErrors) HasErrors() bool {
+	for _, e := range errs {
+		if e.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate a definition without creating it. Returns warnings as well as errors
+func VALIDATE_WF(json_bytes []byte) ValidationErrors {
+	var wf WF
+	err := json.Unmarshal(json_bytes, &wf)
+	if err != nil {
+		return ValidationErrors{{Message: "invalid json: " + err.Error(), Severity: SEVERITY_ERROR}}
+	}
+	if len(wf.Steps) == 0 {
+		dslWorkflow, err := NEW_STATEMENT_WORKFLOW(json_bytes)
+		if err == nil && !dslWorkflow.Root.empty() {
+			wf = dslWorkflow.ToWF()
+		}
+	}
+	return wf.Validate()
+}
+
+// Check the steps of a definition before they are expanded into activities
+func (wf *WF) Validate() ValidationErrors {
+	v := &validator{}
+	if len(wf.Steps) == 0 {
+		v.add("steps", SEVERITY_ERROR, "workflow has no steps")
+	}
+	if wf.Retry != nil {
+		v.retry(wf.Retry, "retry")
+	}
+	for _, k := range sortedKeys(wf.Variables) {
+		v.variable(k, "variables."+k)
+	}
+	v.params(wf.Params)
+	v.schema(wf.Output, "output")
+	v.steps(wf.Steps, "steps")
+	v.steps(wf.Finally, "finally")
+	return v.errs
+}
+
+func (v *validator) add(path string, severity string, message string) {
+	v.errs = append(v.errs, ValidationError{Path: path, Message: message, Severity: severity})
+}
+
+// Validate a list of steps that is run as one (sub) workflow
+func (v *validator) steps(steps []*Step, path string) {
+	scope := &validationScope{names: make(map[string]string)}
+	v.collect(scope, steps, path)
+	for i, s := range steps {
+		v.step(scope, s, path+"["+strconv.Itoa(i)+"]")
+	}
+}
+
+// Collect the step names in the same order as createActivitiesFromSteps
+func (v *validator) collect(scope *validationScope, steps []*Step, path string) {
+	for i, s := range steps {
+		p := path + "[" + strconv.Itoa(i) + "]"
+		if s == nil {
+			v.add(p, SEVERITY_ERROR, "step is null")
+			continue
+		}
+		if s.Name == "" {
+			v.add(p+".name", SEVERITY_WARNING, "step has no name, it can't be a next/switch target")
+		} else if first, ok := scope.names[s.Name]; ok {
+			v.add(p+".name", SEVERITY_ERROR, "duplicate step name "+strconv.Quote(s.Name)+", first used at "+first)
+		} else {
+			scope.names[s.Name] = p
+		}
+		if s.For == nil {
+			v.collect(scope, s.Children, p+".children")
+		}
+	}
+}
+
+func (v *validator) step(scope *validationScope, s *Step, path string) {
+	if s == nil {
+		return
+	}
+
+	kinds := []string{}
+	if s.Call != "" {
+		kinds = append(kinds, "call")
+		if _, ok := CALLS[s.Call]; !ok {
+			v.add(path+".call", SEVERITY_ERROR, "unknown call "+strconv.Quote(s.Call))
+		}
+	}
+	if s.Parallel != nil {
+		kinds = append(kinds, "parallel")
+		v.parallel(s.Parallel, path+".parallel")
+	}
+	if s.For != nil {
+		kinds = append(kinds, "for")
+		v.forStep(s, path)
+	}
+	if len(s.Try) > 0 {
+		kinds = append(kinds, "try")
+		v.steps(s.Try, path+".try")
+	}
+	if s.Approval != nil {
+		kinds = append(kinds, "approval")
+		v.approval(scope, s.Approval, path+".approval")
+	}
+	if len(kinds) > 1 {
+		v.add(path, SEVERITY_ERROR, "a step can only have one of call/parallel/for/try/approval, found "+strings.Join(kinds, ", "))
+	}
+
+	if s.Except != nil {
+		if len(s.Try) == 0 {
+			v.add(path+".except", SEVERITY_ERROR, "except without try")
+		}
+		if s.Except.As != "" {
+			v.variable(s.Except.As, path+".except.as")
+		}
+		v.steps(s.Except.Steps, path+".except.steps")
+	}
+
+	if s.Retry != nil {
+		v.retry(s.Retry, path+".retry")
+	}
+
+	if s.Result != "" {
+		v.variable(s.Result, path+".result")
+	}
+
+	assigned := make(map[string]bool)
+	for _, a := range s.Assign {
+		v.variable(a.Name, path+".assign."+a.Name)
+		assigned[a.Name] = true
+		if len(s.Assignkeys) > 0 && !contains(s.Assignkeys, a.Name) {
+			v.add(path+".assign."+a.Name, SEVERITY_WARNING, "not listed in assignkeys, it's assigned after the listed keys")
+		}
+	}
+	for _, k := range s.Assignkeys {
+		if !assigned[k] {
+			v.variable(k, path+".assignkeys")
+			v.add(path+".assignkeys", SEVERITY_WARNING, "assign key "+strconv.Quote(k)+" has no value in assign")
+		}
+	}
+
+	if s.Next != "" {
+		v.target(scope, s.Next, path+".next")
+	}
+
+	if s.Call == "sleep" {
+		v.sleep(s.Args, path+".args")
+	}
+	if s.Call == "workflow" {
+		v.child(s.Args, path+".args")
+	}
+
+	if s.Timeout_next != "" {
+		if s.Call != "wait.signal" {
+			v.add(path+".timeout_next", SEVERITY_WARNING, "timeout_next is only used by wait.signal")
+		} else if s.Args["timeout"] == nil {
+			v.add(path+".timeout_next", SEVERITY_WARNING, "wait.signal has no timeout, timeout_next is never taken")
+		}
+		v.target(scope, s.Timeout_next, path+".timeout_next")
+	}
+
+	if len(s.Switch) > 0 && string(s.Switch) != "null" {
+		var switches []SwitchT
+		err := json.Unmarshal(s.Switch, &switches)
+		if err != nil {
+			v.add(path+".switch", SEVERITY_ERROR, "malformed switch, expected [{condition, next}]: "+err.Error())
+		}
+		for i, sw := range switches {
+			p := path + ".switch[" + strconv.Itoa(i) + "]"
+			if strings.TrimSpace(sw.Condition) == "" {
+				v.add(p+".condition", SEVERITY_ERROR, "empty condition")
+			}
+			if sw.Next == "" {
+				v.add(p+".next", SEVERITY_ERROR, "switch has no next")
+			} else {
+				v.target(scope, sw.Next, p+".next")
+			}
+		}
+	}
+
+	if len(s.Match) > 0 && string(s.Match) != "null" {
+		var match MatchT
+		err := json.Unmarshal(s.Match, &match)
+		if err != nil {
+			v.add(path+".match", SEVERITY_ERROR, "malformed match, expected {on, conditions}: "+err.Error())
+		} else {
+			if match.On == nil {
+				v.add(path+".match.on", SEVERITY_ERROR, "match has no on")
+			}
+			if len(match.Conditions) == 0 {
+				v.add(path+".match.conditions", SEVERITY_ERROR, "match has no conditions")
+			}
+		}
+	}
+
+	if s.For != nil {
+		v.steps(s.Children, path+".children")
+	} else {
+		for i, c := range s.Children {
+			v.step(scope, c, path+".children["+strconv.Itoa(i)+"]")
+		}
+	}
+}
+
+func (v *validator) parallel(p *ParallelT, path string) {
+	if len(p.Branches) == 0 {
+		v.add(path+".branches", SEVERITY_ERROR, "parallel has no branches")
+	}
+	names := make(map[string]bool)
+	for i, b := range p.Branches {
+		bp := path + ".branches[" + strconv.Itoa(i) + "]"
+		if b == nil {
+			v.add(bp, SEVERITY_ERROR, "branch is null")
+			continue
+		}
+		if b.Name == "" {
+			v.add(bp+".name", SEVERITY_ERROR, "branch has no name")
+		} else if names[b.Name] {
+			v.add(bp+".name", SEVERITY_ERROR, "duplicate branch name "+strconv.Quote(b.Name))
+		}
+		names[b.Name] = true
+		if len(b.Steps) == 0 {
+			v.add(bp+".steps", SEVERITY_WARNING, "branch has no steps")
+		}
+		v.steps(b.Steps, bp+".steps")
+	}
+}
+
+func (v *validator) forStep(s *Step, path string) {
+	if strings.TrimSpace(s.For.In) == "" {
+		v.add(path+".for.in", SEVERITY_ERROR, "for has no in expression")
+	}
+	if s.For.Value != "" {
+		v.variable(s.For.Value, path+".for.value")
+	}
+	if s.For.Index != "" {
+		v.variable(s.For.Index, path+".for.index")
+	}
+	if s.For.Concurrency < 0 {
+		v.add(path+".for.concurrency", SEVERITY_ERROR, "concurrency can't be negative")
+	}
+	if len(s.Children) == 0 {
+		v.add(path+".children", SEVERITY_WARNING, "for has no children")
+	}
+}
+
+func (v *validator) approval(scope *validationScope, a *ApprovalT, path string) {
+	if a.Timeout < 0 {
+		v.add(path+".timeout", SEVERITY_ERROR, "timeout can't be negative")
+	}
+	if a.Escalate != "" {
+		if a.Timeout == 0 {
+			v.add(path+".escalate", SEVERITY_WARNING, "approval has no timeout, escalate is never taken")
+		}
+		v.target(scope, a.Escalate, path+".escalate")
+	}
+	if a.As != "" {
+		v.variable(a.As, path+".as")
+	}
+	v.steps(a.Notify, path+".notify")
+}
+
+// Expressions are only known at runtime, literal values are checked here
+func (v *validator) sleep(args map[string]interface{}, path string) {
+	n := 0
+	for _, k := range []string{"seconds", "duration", "until"} {
+		val, ok := args[k]
+		if !ok {
+			continue
+		}
+		n++
+		str := toString(val)
+		if IsJS(str) {
+			continue
+		}
+		var err error
+		switch k {
+		case "seconds":
+			_, err = strconv.ParseFloat(str, 64)
+		case "duration":
+			_, err = PARSE_DURATION(str)
+		case "until":
+			_, err = PARSE_TIME(str)
+		}
+		if err != nil {
+			v.add(path+"."+k, SEVERITY_ERROR, err.Error())
+		}
+	}
+	if n == 0 {
+		v.add(path, SEVERITY_ERROR, "sleep needs seconds, duration or until")
+	} else if n > 1 {
+		v.add(path, SEVERITY_WARNING, "sleep has more than one of seconds/duration/until, until wins over duration over seconds")
+	}
+}
+
+// Inline definitions are validated like a root definition
+func (v *validator) child(args map[string]interface{}, path string) {
+	def, ok := args["definition"]
+	if !ok || def == nil {
+		if toString(args["name"]) == "" {
+			v.add(path, SEVERITY_ERROR, "workflow needs a definition or a name")
+		}
+		return
+	}
+	bs, _ := json.Marshal(def)
+	for _, e := range VALIDATE_WF(bs) {
+		e.Path = path + ".definition." + e.Path
+		v.errs = append(v.errs, e)
+	}
+	if vars, ok := args["args"]; ok {
+		if _, ok := vars.(map[string]interface{}); !ok {
+			v.add(path+".args", SEVERITY_ERROR, "args must be an object of variables")
+		}
+	}
+}
+
+func (v *validator) params(params []*ParamT) {
+	seen := make(map[string]bool)
+	for i, p := range params {
+		path := "params[" + strconv.Itoa(i) + "]"
+		if p == nil {
+			v.add(path, SEVERITY_ERROR, "param is null")
+			continue
+		}
+		v.variable(p.Name, path+".name")
+		if seen[p.Name] {
+			v.add(path+".name", SEVERITY_ERROR, "duplicate param "+strconv.Quote(p.Name))
+		}
+		seen[p.Name] = true
+		if _, ok := TYPE_NAMES[p.Type]; !ok {
+			v.add(path+".type", SEVERITY_ERROR, "unknown type "+strconv.Quote(p.Type)+", expected integer, float, boolean, json or string")
+			continue
+		}
+		if p.Default != nil {
+			if _, err := p.coerce(p.Default); err != nil {
+				v.add(path+".default", SEVERITY_ERROR, err.Error())
+			}
+			if p.Required {
+				v.add(path+".default", SEVERITY_WARNING, "required param has a default, it's never used")
+			}
+		}
+	}
+}
+
+func (v *validator) schema(s *SchemaT, path string) {
+	if s == nil {
+		return
+	}
+	if s.Type != "" && !contains(SCHEMA_TYPES, s.Type) {
+		v.add(path+".type", SEVERITY_ERROR, "unknown type "+strconv.Quote(s.Type)+", expected one of "+strings.Join(SCHEMA_TYPES, ", "))
+	}
+	if len(s.Properties) > 0 && s.Type != "" && s.Type != "object" {
+		v.add(path+".properties", SEVERITY_WARNING, "properties are only checked for objects")
+	}
+	if s.Items != nil && s.Type != "" && s.Type != "array" {
+		v.add(path+".items", SEVERITY_WARNING, "items are only checked for arrays")
+	}
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; !ok && len(s.Properties) > 0 {
+			v.add(path+".required", SEVERITY_WARNING, "required property "+strconv.Quote(name)+" isn't in properties")
+		}
+	}
+	for _, name := range s.propertyNames() {
+		v.schema(s.Properties[name], path+".properties."+name)
+	}
+	v.schema(s.Items, path+".items")
+}
+
+func (v *validator) retry(r *RetryT, path string) {
+	if r.MaxAttempts < 0 {
+		v.add(path+".maxattempts", SEVERITY_ERROR, "can't be negative")
+	}
+	if r.InitialInterval < 0 {
+		v.add(path+".initialinterval", SEVERITY_ERROR, "can't be negative")
+	}
+	if r.MaxInterval < 0 {
+		v.add(path+".maxinterval", SEVERITY_ERROR, "can't be negative")
+	}
+	if r.BackoffCoefficient != 0 && r.BackoffCoefficient < 1 {
+		v.add(path+".backoffcoefficient", SEVERITY_ERROR, "must be 1 or larger")
+	}
+}
+
+func (v *validator) target(scope *validationScope, name string, path string) {
+	if _, ok := scope.names[name]; !ok {
+		v.add(path, SEVERITY_ERROR, "no step named "+strconv.Quote(name)+" to jump to")
+	}
+}
+
+func (v *validator) variable(name string, path string) {
+	if !R_JS_VAR.MatchString(name) {
+		v.add(path, SEVERITY_ERROR, strconv.Quote(name)+" is not a valid variable name")
+		return
+	}
+	if contains(JS_RESERVED, strings.Split(name, ".")[0]) {
+		v.add(path, SEVERITY_ERROR, strconv.Quote(name)+" is a reserved word")
+	}
+}
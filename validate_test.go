@@ -0,0 +1,72 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		def      string
+		expected []string // severity: path: message of every error and warning, in order
+	}{
+		{`{"name":"ok","steps":[{"name":"a","call":"noops","next":"b"},{"name":"b","return":"1"}]}`, nil},
+		{`{"name":"empty","steps":[]}`, []string{"error: steps: workflow has no steps"}},
+		{`{"steps":[{"name":"a"},{"name":"a","next":"nowhere"}]}`, []string{
+			`error: steps[1].name: duplicate step name "a", first used at steps[0]`,
+			`error: steps[1].next: no step named "nowhere" to jump to`,
+		}},
+		{`{"steps":[{"call":"frobnicate","parallel":{"branches":[]}}]}`, []string{
+			"warning: steps[0].name: step has no name, it can't be a next/switch target",
+			`error: steps[0].call: unknown call "frobnicate"`,
+			"error: steps[0].parallel.branches: parallel has no branches",
+			"error: steps[0]: a step can only have one of call/parallel/for/try/approval, found call, parallel",
+		}},
+		{`{"steps":[{"name":"a","assign":{"1x":"1","for":"2"},"result":"user.name"}]}`, []string{
+			`error: steps[0].assign.1x: "1x" is not a valid variable name`,
+			`error: steps[0].assign.for: "for" is a reserved word`,
+		}},
+		{`{"steps":[{"name":"a","except":{"steps":[]}},{"name":"f","for":{"concurrency":-1}}]}`, []string{
+			"error: steps[0].except: except without try",
+			"error: steps[1].for.in: for has no in expression",
+			"error: steps[1].for.concurrency: concurrency can't be negative",
+			"warning: steps[1].children: for has no children",
+		}},
+		{`{"steps":[{"name":"s","call":"sleep","args":{}},{"name":"r","call":"noops","retry":{"maxattempts":-1,"backoffcoefficient":0.5}}]}`, []string{
+			"error: steps[0].args: sleep needs seconds, duration or until",
+			"error: steps[1].retry.maxattempts: can't be negative",
+			"error: steps[1].retry.backoffcoefficient: must be 1 or larger",
+		}},
+		// Step names of a for body are their own scope, the outer steps can't jump into it
+		{`{"steps":[{"name":"f","for":{"in":"[1]"},"children":[{"name":"in","return":"1"}]},{"name":"x","next":"in"}]}`, []string{
+			`error: steps[1].next: no step named "in" to jump to`,
+		}},
+		{`{"steps":[{"name":"a","return":"1"}],"finally":[{"name":"a","call":"noops"}]}`, nil},
+	} {
+		errs := VALIDATE_WF([]byte(c.def))
+		var got []string
+		for _, e := range errs {
+			got = append(got, e.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(c.expected, "\n") {
+			t.Errorf("%s\n got: %q\nwant: %q", c.def, got, c.expected)
+		}
+	}
+}
+
+func TestValidationErrorsSeverity(t *testing.T) {
+	warnings := VALIDATE_WF([]byte(`{"steps":[{"call":"noops"}]}`))
+	if len(warnings) != 1 || warnings.HasErrors() {
+		t.Error(warnings)
+	}
+	// Warnings don't stop a definition from being created
+	if _, err := NEW_WF([]byte(`{"steps":[{"call":"noops"}]}`)); err != nil {
+		t.Error(err)
+	}
+	if _, err := NEW_WF([]byte(`{"steps":[{"name":"a","next":"b"}]}`)); err == nil {
+		t.Error("invalid next accepted")
+	}
+	if errs := VALIDATE_WF([]byte(`{"steps":`)); len(errs) != 1 || !strings.HasPrefix(errs[0].Message, "invalid json: ") {
+		t.Error(errs)
+	}
+}
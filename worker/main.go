@@ -2,7 +2,6 @@ package main
 
 import (
 	"log"
-	"os"
 
 	"github.com/joho/godotenv"
 	"go.temporal.io/sdk/client"
@@ -21,10 +20,7 @@ func main() {
 	app.InitWorkflowGlobals() // This will load the js file into memory
 
 	// Create the client object just once per process
-	option := client.Options{}
-	if os.Getenv("HOSTPORT") != "" {
-		option = client.Options{HostPort: os.Getenv("HOSTPORT")}
-	}
+	option := app.CLIENT_OPTIONS()
 
 	c, err := client.NewClient(option)
 	if err != nil {
@@ -35,6 +31,8 @@ func main() {
 	w := worker.New(c, app.WorkflowEngineTaskQueue, worker.Options{})
 
 	w.RegisterWorkflow(app.WorkflowEngineMain)
+	w.RegisterWorkflow(app.StatementWorkflowMain)
+	w.RegisterWorkflow(app.ScheduleWorkflowMain)
 	w.RegisterActivity(&app.ActivityType{})
 
 	err = w.Run(nil) // Don't stop on error
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -13,8 +14,8 @@ import (
 	"encoding/json"
 
 	"github.com/robertkrimen/otto"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
-	"rogchap.com/v8go"
 )
 
 const (
@@ -40,10 +41,11 @@ type (
 		Url     string
 		Method  string
 		Headers map[string]string
-		Body    map[string]string
-		Query   map[string]string
-		Auth    string
-		Timeout int
+		Body    interface{}            // JSON object, form values or a raw string
+		Query   map[string]interface{} // Merged with the query already in Url
+		Auth    string                 // "Bearer xyz", "user:password" or a bare token
+		Timeout int                    // Seconds
+		RetryOn []int                  // Statuses failing the step with a retryable HttpError, default 429 and 5xx
 	}
 
 	Args_Sleep struct {
@@ -59,6 +61,44 @@ type (
 		Next      string
 	}
 
+	// Named branches of a parallel step. Every branch is a list of steps run as its own sub workflow
+	ParallelT struct {
+		Branches []*BranchT
+	}
+	BranchT struct {
+		Name  string
+		Steps []*Step
+	}
+
+	// Run the children of a step once per element of the array In evaluates to. Value/Index name the JS variables
+	// bound to the current item and its index. Concurrency > 1 runs that many iterations at a time, each in its own
+	// JS context
+	ForT struct {
+		In          string
+		Value       string
+		Index       string
+		Concurrency int
+	}
+
+	// Temporal retry policy of the activity of a step (or of every step when set on the WF). Intervals are in seconds
+	RetryT struct {
+		MaxAttempts        int32
+		InitialInterval    int
+		BackoffCoefficient float64
+		MaxInterval        int
+		NonRetryable       []string // Error kinds that are never retried
+	}
+
+	// Handler of a try block. Errors lists the error kinds it catches (all when empty) and As is the JS variable the
+	// error object { kind, message, step } is bound to
+	ExceptT struct {
+		Errors []string
+		As     string
+		Steps  []*Step
+	}
+
+	scopeKey struct{}
+
 	// Each step/activity is a task that's individually executed by the engine in series
 	Step struct {
 		Name       string
@@ -67,13 +107,23 @@ type (
 		Variables  map[string]interface{}
 		Result     string
 		Return     string
-		Assign     map[string]interface{}
-		Assignkeys []string
+		Assign     AssignT
+		Assignkeys []string // Order of an assign object, from before assign kept its order
 		Error      string
 		Switch     json.RawMessage
 		Match      json.RawMessage
 		Next       string
 		Children   []*Step
+		Parallel   *ParallelT
+		For        *ForT
+		Retry      *RetryT
+		Try        []*Step
+		Except     *ExceptT
+
+		Timeout_next string // Step to jump to when a wait.signal times out
+		Approval     *ApprovalT
+
+		jump string // Set while executing, e.g. timeout_next when the wait timed out
 	}
 
 	// Root workflow type => This is where the JSON get's converted to
@@ -84,6 +134,12 @@ type (
 		Steps      []*Step // JSON object
 		Activities []*Step // Will be ordered: depth first from root => end
 		Timeout    int
+		Retry      *RetryT // Default for all the steps
+		Finally    []*Step // Always run at the end, also when the workflow failed or was canceled (compensation)
+		Version    int     // Version of a stored definition, 0 when the definition was sent with the run
+		Params     []*ParamT
+		Output     *SchemaT // Schema of the return value
+		Schedule   string   // ID of the schedule that started the run, signaled when it ends
 	}
 
 	// Workflow is the type used to express the workflow definition. Variables are a map of valuables. Variables can be
@@ -127,6 +183,21 @@ type (
 )
 
 var R_IS_JS, _ = regexp.Compile("\\$\\{[^\\}]+\\}")
+
+// Step call => activity name. A step without a call only runs its JS
+var CALLS = map[string]string{
+	"sleep":        "Sleep", // A durable timer, the activity is only used by runs started before timers
+	"http.get":     "CallHttp",
+	"http.post":    "HttpRequest",
+	"http.put":     "HttpRequest",
+	"http.patch":   "HttpRequest",
+	"http.delete":  "HttpRequest",
+	"http.request": "HttpRequest",
+	"noops":        "NopActivity",
+	"wait.signal":  "", // Run by the workflow itself, see waitSignal
+	"workflow":     "", // Child workflow, see executeWorkflow
+}
+
 var Z_SRC = ""
 
 // Recurssivly insert steps => Depth Firts
@@ -139,10 +210,6 @@ func (wf *WF) insertSteps(current *Step) {
 		current.Variables = make(map[string]interface{})
 	}
 
-	if current.Assign == nil {
-		current.Assign = make(map[string]interface{})
-	}
-
 	if current.Children == nil {
 		current.Children = []*Step{}
 	}
@@ -156,6 +223,9 @@ func (wf *WF) insertSteps(current *Step) {
 	}
 
 	wf.Activities = append(wf.Activities, current)
+	if current.For != nil {
+		return // Children are the loop body, they are run by the for step itself
+	}
 	for _, s := range current.Children {
 		wf.insertSteps(s)
 	}
@@ -179,17 +249,33 @@ func (wf *WF) findStepIndex(name string) (int, error) {
 	return -1, errors.New("No steps found with name: " + name)
 }
 
-// Constructor function to create a new workflow
+// Constructor function to create a new workflow. Invalid definitions return ValidationErrors
 func NEW_WF(json_bytes []byte) (WF, error) {
 	var wf WF
 	err := json.Unmarshal(json_bytes, &wf)
+	if err != nil {
+		return wf, ValidationErrors{{Message: "invalid json: " + err.Error(), Severity: SEVERITY_ERROR}}
+	}
+	if len(wf.Steps) == 0 {
+		// Older Statement format => convert, then validated like any WF
+		dslWorkflow, err := NEW_STATEMENT_WORKFLOW(json_bytes)
+		if err == nil && !dslWorkflow.Root.empty() {
+			wf = dslWorkflow.ToWF()
+		}
+	}
+
+	errs := wf.Validate()
+	if errs.HasErrors() {
+		return wf, errs
+	}
+
 	wf.createActivitiesFromSteps()
 
 	if wf.Variables == nil {
 		wf.Variables = make(map[string]interface{})
 	}
 
-	return wf, err
+	return wf, nil
 }
 
 // Main workflow func executed by temporal
@@ -202,17 +288,80 @@ func WorkflowEngineMain(ctx workflow.Context, wf WF) (interface{}, error) {
 		ao.StartToCloseTimeout = time.Duration(wf.Timeout) * time.Second
 	}
 
+	if wf.Retry != nil {
+		ao.RetryPolicy = wf.Retry.policy()
+	}
+
 	ctx = workflow.WithActivityOptions(ctx, ao)
 	logger := workflow.GetLogger(ctx)
 
+	ctx, err := withRunState(ctx)
+	if err != nil {
+		return "", err
+	}
+	if parent := workflow.GetInfo(ctx).ParentWorkflowExecution; parent != nil && wf.Schedule != "" && parent.ID == wf.Schedule {
+		defer notifySchedule(ctx, wf.Schedule)
+	}
+
 	// @todo: If JS required
-	v8, _ := v8go.NewContext()
+	js, err := newWorkflowJS(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer js.Close()
+
+	err = wf.bindVariables(js)
+	if err != nil {
+		return "", err
+	}
+
+	err = wf.run(ctx, js)
+	if len(wf.Finally) > 0 {
+		ferr := wf.runFinally(ctx, js, err)
+		if ferr != nil {
+			logger.Error("Finally failed.", "Error", ferr)
+			if err == nil {
+				err = ferr
+			}
+		}
+	}
+	if err != nil {
+		logger.Error("Workflow failed.", "Error", err)
+		return "", err
+	}
+	logger.Info("Workflow completed.")
+
+	if errs := jsErrors(js); len(errs) > 0 {
+		wf.Error = strings.Join(errs, "\n")
+		logger.Error("Workflow failed.", "Error", wf.Error)
+		return nil, temporal.NewNonRetryableApplicationError(errs[0], ERROR_KIND_JS, nil, errs)
+	}
 
-	v8.RunScript(Z_SRC, "z.js")
+	returnValue, err := wf.result()
+	if err != nil {
+		logger.Error("Workflow failed.", "Error", err)
+		return nil, err
+	}
+	return returnValue, nil
+}
 
-	code := "let ERRORS = [];"
-	v8.RunScript(code, "init.js")
+// The initial variables (e.g. the args of a child workflow) become JS variables
+func (wf *WF) bindVariables(js JSEngine) error {
+	for _, k := range sortedKeys(wf.Variables) {
+		bs, err := json.Marshal(wf.Variables[k])
+		if err != nil {
+			return err
+		}
+		err = js.Set(k, string(bs))
+		if err != nil {
+			return temporal.NewNonRetryableApplicationError("variable "+k+": "+err.Error(), ERROR_KIND_ARGS, nil)
+		}
+	}
+	return nil
+}
 
+// Run all the activities of wf one after another, following the switch/next jumps
+func (wf *WF) run(ctx workflow.Context, js JSEngine) error {
 	// This for loop takes care of nested steps as well
 	// because we are converting all nseted steps to an array with depth first order
 	noOfActivityDone := 0
@@ -224,15 +373,30 @@ func WorkflowEngineMain(ctx workflow.Context, wf WF) (interface{}, error) {
 			break
 		}
 
+		// Steps without an activity don't notice a cancel otherwise
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
 		step := wf.Activities[i]
-		err := step.execute(ctx, v8)
+		bindScope(ctx, js)
+		started := nowMs(ctx)
+		stepStarted(ctx, step)
+		err := step.execute(ctx, js)
+		if err == nil {
+			err = takeJSLimit(js)
+		}
+		stepEnded(ctx, step, started, err)
 		if err != nil {
-			logger.Error("Workflow failed.", "Error", err)
-			return "", err
+			return &StepError{Step: step.Name, Err: err}
 		}
 
 		// Replace all wf variables with the result of this step
 		for k, v := range step.Variables {
+			if k == "return" {
+				wf.Variables[k] = v // Already JSON, unescaping would turn "abc" into abc
+				continue
+			}
 			wf.Variables[k] = UnEscapeStr(v.(string))
 			// wf.Variables[k] = v.(string)
 		}
@@ -242,13 +406,22 @@ func WorkflowEngineMain(ctx workflow.Context, wf WF) (interface{}, error) {
 			break
 		}
 
+		if step.jump != "" {
+			nextI, err := wf.findStepIndex(step.jump)
+			if err == nil {
+				log.Println("TIMEOUT: Next => " + step.jump)
+				i = nextI // JUMP
+				continue
+			}
+		}
+
 		// SWITCH
 		var switches []SwitchT
 		json.Unmarshal(step.Switch, &switches)
 		if len(switches) > 0 {
 			shouldJump := false
 			for _, sw := range switches {
-				val, _ := runJS(sw.Condition, v8, "switch")
+				val, _ := runJS(sw.Condition, js, "switch")
 				if val == "true" {
 					log.Println(sw.Condition)
 					log.Println("CONDITION TRUE: Next => " + sw.Next)
@@ -285,119 +458,118 @@ func WorkflowEngineMain(ctx workflow.Context, wf WF) (interface{}, error) {
 
 		i++
 	}
-	logger.Info("Workflow completed.")
-
-	for k, v := range wf.Variables {
-		log.Println("Variables => ", k, v)
-	}
-
-	returnValue := wf.Variables["return"]
-
-	jserr, _ := v8.RunScript("JSON.stringify(ERRORS)", "error.js")
-	if jserr != nil {
-		errs := jserr.String()
-		if (errs == "[]") || (errs == "") || (errs == "\"\"") || (errs == "null") {
-		} else {
-			log.Println("JS Error: ", errs)
-			wf.Error = jserr.String()
-			return returnValue, errors.New(wf.Error)
-		}
-	}
-
-	return returnValue, nil
+	return nil
 }
 
 // Each step is executed with ARGS/ASSIGN/RESULT/MATCH/RETURN
-func (s *Step) execute(ctx workflow.Context, v8 *v8go.Context) error {
+func (s *Step) execute(ctx workflow.Context, js JSEngine) error {
 	var result string
 
-	ActivityName := ""
-	switch s.Call {
-	case "sleep":
-		ActivityName = "Sleep"
-		break
-	case "http.get":
-		ActivityName = "CallHttp"
-		break
-	case "noops":
-		ActivityName = "NopActivity"
-		break
-	default:
-		ActivityName = ""
-	}
-
-	// JS code to run in v8
-	code := ""
+	ActivityName := CALLS[s.Call] // "" => no activity, just the JS
 
 	// Before Activity Parse Expression in inputs
 
 	// ASSIGN
-	for _, k := range s.Assignkeys {
-		v := s.Assign[k] // Go doesn't have sorted keys
+	for _, a := range s.assignments() {
+		k, v := a.Name, a.Value
 		bs, ok := json.Marshal(v)
-		vs := string(bs)
+		vs := UnEscapeStr(string(bs))
+		if str, isString := v.(string); isString {
+			vs = str // The expression as written, JSON escapes (\n, \u003e for >) aren't JS outside a string
+		}
 		if ok == nil && vs != "" {
-			vs = UnEscapeStr(vs)
-			code = k + " = " + vs // "num: 1" => num = 1
-			val, err := v8.RunScript(code, "assign.js")
+			_, err := js.Assign(k, vs, "assign.js") // "num: 1" => num = 1
 			if err != nil {
-				log.Println("ASSIGN: code ", code, err)
-				code = "ERRORS.push(JSON.stringify(" + err.Error() + "));"
-				v8.RunScript(code, "assign.error.js")
-			} else {
-				log.Println("Assigned "+k, " = ", val.String())
-				// s.Assign[k] = val.String() // Assigned vars ready for activity
-				// Don't change Assign code . When iterating it doesn't help.
-				// Also anyway s.Assign isn't used anywhere directly. variables are used through JS
+				recordJSError(js, "step "+s.Name+": assign "+k, err)
 			}
 		}
 	}
 
 	// ARGS
-	for k, v := range s.Args {
-		// IF STRING
-		// ELSE
-		vs, ok := v.(string)
-		if ok && (vs != "") && IsJS(vs) {
-			vs = UnEscapeStr(vs)
-			code = "`" + vs + "`" // "abc${2+3}def" => "abc5def"
-			val, err := v8.RunScript(code, "args.js")
-			if err != nil {
-				code = "ERRORS.push(JSON.stringify(" + err.Error() + "));"
-				v8.RunScript(code, "args.error.js")
-				log.Println("ARGS: code ERR: ", code, err)
-			} else {
-				s.Args[k] = val.String() // Inputs ready for activity
-			}
+	// Sorted, as map order is random and the expressions must run in the same order on a replay
+	for _, k := range sortedKeys(s.Args) {
+		if s.Call == "workflow" && k == "definition" {
+			continue // Expressions of a child definition run in the child
+		}
+		if s.Call == "workflow" && k == "args" {
+			s.Args[k] = evalVariables(s.Args[k], js, "step "+s.Name+": args")
+			continue
 		}
+		s.Args[k] = evalArg(s.Args[k], js, "step "+s.Name+": args") // Inputs ready for activity
+	}
+	if err := takeJSLimit(js); err != nil {
+		return err // Before the activity runs
 	}
 
 	// IF No activity just do the JS task
-	if ActivityName == "" {
+	if s.Parallel != nil {
+		r, err := s.executeParallel(ctx, js)
+		if err != nil {
+			return err
+		}
+		result = r
+	} else if s.For != nil {
+		r, err := s.executeFor(ctx, js)
+		if err != nil {
+			return err
+		}
+		result = r
+	} else if len(s.Try) > 0 {
+		err := s.executeTry(ctx, js)
+		if err != nil {
+			return err
+		}
+	} else if s.Approval != nil {
+		r, err := s.executeApproval(ctx, js)
+		if err != nil {
+			return err
+		}
+		result = r
+	} else if s.Call == "sleep" && workflow.GetVersion(ctx, VERSION_SLEEP_TIMER, workflow.DefaultVersion, 1) == 1 {
+		err := s.sleep(ctx)
+		if err != nil {
+			return err
+		}
+	} else if s.Call == "workflow" {
+		r, err := s.executeWorkflow(ctx)
+		if err != nil {
+			return err
+		}
+		result = r
+	} else if s.Call == "wait.signal" {
+		r, err := s.waitSignal(ctx)
+		if err != nil {
+			return err
+		}
+		result = r
+	} else if ActivityName == "" {
 		log.Println("STEP: " + s.Name + " NO Activity")
 	} else {
-		err := workflow.ExecuteActivity(ctx, ActivityName, s).Get(ctx, &result)
+		actx := ctx
+		if s.Retry != nil {
+			actx = workflow.WithRetryPolicy(ctx, *s.Retry.policy())
+		}
+		if timeout := s.httpTimeout(); timeout > 0 {
+			// Longer than the request, so it fails with its HttpError and isn't cut off by a TimeoutError
+			actx = workflow.WithStartToCloseTimeout(actx, timeout+HTTP_TIMEOUT_MARGIN)
+		}
+		err := workflow.ExecuteActivity(actx, ActivityName, s).Get(ctx, &result)
 		if err != nil {
 			return err
 		}
 	}
+	bindScope(ctx, js) // Other iterations may have run while waiting
 
 	// RESULT
 	// In Result just put's the result of the activity
 	if s.Result != "" {
-		if IsJSON(result) {
-			code = s.Result + " = " + result + "; "
-		} else {
-			code = s.Result + " = '" + result + "'; "
+		value := result
+		if !IsJSON(result) {
+			value = "'" + result + "'"
 		}
-		// code = s.Result + " = JSON.parse(" + result + ");" // This doesn't work why?
-		_, err := v8.RunScript(code, "result.js")
+		_, err := js.Assign(s.Result, value, "result.js")
 		if err != nil {
-			if err != nil {
-				log.Println("RESULT: code => ", code, err)
-				code = "ERRORS.push(JSON.stringify(" + err.Error() + "));"
-				v8.RunScript(code, "result.error.js")
-			}
+			recordJSError(js, "step "+s.Name+": result", err)
 		}
 
 		// Just store the value as result of this step
@@ -414,12 +586,9 @@ func (s *Step) execute(ctx workflow.Context, v8 *v8go.Context) error {
 			if ons != "null" {
 				ons = UnEscapeStr(ons) // on: currentTime.dayOfTheWeek
 				code := "z.matches(" + ons + ")(" + strings.Join(match.Conditions, ", ") + ")"
-				_, err = v8.RunScript(code, "match.js")
-				log.Println("MATCH: ", code, err)
+				_, err = js.Eval(code, "match.js")
 				if err != nil {
-					log.Println("MATCH: ", code, err)
-					code = "ERRORS.push(JSON.stringify(" + err.Error() + "));"
-					v8.RunScript(code, "return.error.js")
+					recordJSError(js, "step "+s.Name+": match", err)
 				}
 			}
 
@@ -434,19 +603,29 @@ func (s *Step) execute(ctx workflow.Context, v8 *v8go.Context) error {
 		// code = "returnValue = JSON.stringify(" + s.Return + "); returnValue"
 		// code = "returnValue = " + s.Return + "; returnValue"
 
-		if IsJS(s.Return) {
-			code = "`" + s.Return + "`" // "abc${2+3}def" => "abc5def"
+		// The return value is kept as JSON. Like args, a return that's just "${expr}" keeps the type of the expression
+		var returnValue string
+		var err error
+		expr := s.Return
+		if loc := R_IS_JS.FindStringIndex(expr); loc != nil && loc[0] == 0 && loc[1] == len(expr) {
+			expr = expr[2 : len(expr)-1]
+		}
+		if IsJS(expr) {
+			returnValue, err = js.Template(s.Return, "return.js") // "abc${2+3}def" => "abc5def"
+			if err == nil {
+				bs, _ := json.Marshal(returnValue)
+				returnValue = string(bs)
+			}
 		} else {
-			code = "returnValue = JSON.stringify(" + s.Return + "); returnValue"
+			returnValue, err = js.Eval("returnValue = JSON.stringify("+expr+"); returnValue", "return.js")
+			if err == nil && !IsJSON(returnValue) {
+				returnValue = "null" // undefined
+			}
 		}
 
-		returnString, err := v8.RunScript(code, "return.js")
 		if err != nil {
-			log.Println("RETURN: code => ", code, err)
-			code = "ERRORS.push(JSON.stringify(" + err.Error() + "));"
-			v8.RunScript(code, "return.error.js")
+			recordJSError(js, "step "+s.Name+": return", err)
 		} else {
-			returnValue := returnString.String()
 			s.Variables["return"] = returnValue
 		}
 	}
@@ -454,6 +633,372 @@ func (s *Step) execute(ctx workflow.Context, v8 *v8go.Context) error {
 	return nil
 }
 
+// Interpolate ${} expressions in an arg value. Nested objects/arrays (e.g. http body, headers) are walked recursively
+func evalArg(v interface{}, js JSEngine, ref string) interface{} {
+	switch t := v.(type) {
+	case string:
+		if t == "" || !IsJS(t) {
+			return t
+		}
+		val, err := js.Template(UnEscapeStr(t), "args.js") // "abc${2+3}def" => "abc5def"
+		if err != nil {
+			recordJSError(js, ref, err)
+			return t
+		}
+		return val
+	case map[string]interface{}:
+		for _, k := range sortedKeys(t) {
+			t[k] = evalArg(t[k], js, ref)
+		}
+		return t
+	case []interface{}:
+		for i, e := range t {
+			t[i] = evalArg(e, js, ref)
+		}
+		return t
+	}
+	return v
+}
+
+// Like evalArg, but a value that's just one "${expr}" keeps the type of the expression, so objects can be passed on
+func evalVariables(v interface{}, js JSEngine, ref string) interface{} {
+	vars, ok := v.(map[string]interface{})
+	if !ok {
+		return evalArg(v, js, ref)
+	}
+	for _, k := range sortedKeys(vars) {
+		str, ok := vars[k].(string)
+		loc := R_IS_JS.FindStringIndex(str)
+		if !ok || loc == nil || loc[0] != 0 || loc[1] != len(str) {
+			vars[k] = evalArg(vars[k], js, ref)
+			continue
+		}
+		val, err := js.Eval("JSON.stringify("+UnEscapeStr(str[2:len(str)-1])+")", "args.js")
+		if err != nil {
+			recordJSError(js, ref, err)
+		} else if val != "" && IsJSON(val) {
+			vars[k] = json.RawMessage(val)
+		}
+	}
+	return vars
+}
+
+// Run every branch concurrently and join. Branches share the JS context, so result variables set inside a branch
+// are visible afterwards. The step result is an object of all the branch variables keyed by branch name
+func (s *Step) executeParallel(ctx workflow.Context, js JSEngine) (string, error) {
+	branches := make([]*WF, len(s.Parallel.Branches))
+	futures := make([]workflow.Future, len(s.Parallel.Branches))
+	for i, b := range s.Parallel.Branches {
+		branch := &WF{Name: b.Name, Steps: cloneSteps(b.Steps), Variables: make(map[string]interface{})}
+		branch.createActivitiesFromSteps()
+		branches[i] = branch
+
+		future, settable := workflow.NewFuture(ctx)
+		workflow.Go(ctx, func(ctx workflow.Context) {
+			err := branch.run(ctx, js)
+			settable.Set(nil, err)
+		})
+		futures[i] = future
+	}
+
+	// Wait for all the branches even if one fails, so that no branch is left running
+	var firstErr error
+	for i, f := range futures {
+		err := f.Get(ctx, nil)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("parallel branch %s: %w", branches[i].Name, err)
+		}
+	}
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	joined := make(map[string]map[string]interface{})
+	for _, branch := range branches {
+		vars := make(map[string]interface{})
+		for k, v := range branch.Variables {
+			vs, _ := v.(string)
+			if IsJSON(vs) {
+				vars[k] = json.RawMessage(vs)
+			} else {
+				vars[k] = vs
+			}
+		}
+		joined[branch.Name] = vars
+	}
+	bs, err := json.Marshal(joined)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// Run the children once for every item. Each iteration gets its own copy of the children and the result is an
+// array with the return value (or the variables) of every iteration, in the order of the items. Iterations one at a
+// time share the JS context, e.g. to add up a total. With concurrency > 1 every iteration gets its own context with a
+// copy of the variables instead, so iterations waiting on an activity can't overwrite each other's variables
+func (s *Step) executeFor(ctx workflow.Context, js JSEngine) (string, error) {
+	in, err := runJS("JSON.stringify("+s.For.In+")", js, "for")
+	if err != nil {
+		return "", err
+	}
+	var items []json.RawMessage
+	err = json.Unmarshal([]byte(in), &items)
+	if err != nil {
+		return "", temporal.NewNonRetryableApplicationError("for: "+s.For.In+" is not an array", ERROR_KIND_WORKFLOW, nil)
+	}
+
+	value := s.For.Value
+	if value == "" {
+		value = "item"
+	}
+
+	isolated := s.For.Concurrency > 1
+	results := make([]json.RawMessage, len(items))
+	iterate := func(ctx workflow.Context, i int) error {
+		ijs := js
+		if isolated {
+			var err error
+			ijs, err = iterationJS(ctx, js)
+			if err != nil {
+				return err
+			}
+			defer ijs.Close()
+		}
+
+		scope := value + " = " + string(items[i]) + ";"
+		if s.For.Index != "" {
+			scope += s.For.Index + " = " + strconv.Itoa(i) + ";"
+		}
+		parent, _ := ctx.Value(scopeKey{}).(string)
+		ctx = workflow.WithValue(ctx, scopeKey{}, parent+scope)
+
+		body := &WF{Name: s.Name + "[" + strconv.Itoa(i) + "]", Steps: cloneSteps(s.Children), Variables: make(map[string]interface{})}
+		body.createActivitiesFromSteps()
+		err := body.run(ctx, ijs)
+		if err != nil {
+			return fmt.Errorf("%s: %w", body.Name, err)
+		}
+
+		if ret, ok := body.Variables["return"].(string); ok && IsJSON(ret) {
+			results[i] = json.RawMessage(ret)
+		} else if ok {
+			results[i], _ = json.Marshal(ret)
+		} else {
+			results[i], _ = json.Marshal(body.Variables)
+		}
+		return nil
+	}
+
+	concurrency := s.For.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(items) {
+		concurrency = len(items)
+	}
+
+	// Workflow coroutines never run at the same time, so a plain counter is enough to hand out the items
+	next := 0
+	var firstErr error
+	futures := make([]workflow.Future, concurrency)
+	for w := 0; w < concurrency; w++ {
+		future, settable := workflow.NewFuture(ctx)
+		workflow.Go(ctx, func(ctx workflow.Context) {
+			for next < len(items) && firstErr == nil {
+				i := next
+				next++
+				err := iterate(ctx, i)
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}
+			settable.Set(nil, nil)
+		})
+		futures[w] = future
+	}
+	for _, f := range futures {
+		f.Get(ctx, nil)
+	}
+	if firstErr != nil {
+		return "", firstErr
+	}
+
+	bs, err := json.Marshal(results)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// New JS context for an iteration with a copy of the variables of js. Variables are the globals that aren't built-ins,
+// functions are left out as they can't be copied as JSON
+func iterationJS(ctx workflow.Context, js JSEngine) (JSEngine, error) {
+	names, err := runJS(fmt.Sprintf(VARIABLE_NAMES_JS, jsGlobals()), js, "variables")
+	if err != nil {
+		return nil, err
+	}
+	var variables []string
+	json.Unmarshal([]byte(names), &variables)
+
+	ijs, err := newWorkflowJS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shareJSRun(js, ijs)
+	for _, name := range variables {
+		val, err := js.Get(name)
+		if err != nil || !R_JS_VAR.MatchString(name) || !IsJSON(val) {
+			continue
+		}
+		err = ijs.Set(name, val)
+		if err != nil {
+			ijs.Close()
+			return nil, err
+		}
+	}
+	return ijs, nil
+}
+
+// Run the try steps. On an error the except kinds are checked, the error is bound to a JS variable and the except steps
+// run instead. Variables of the steps that ran are kept as variables of this step
+func (s *Step) executeTry(ctx workflow.Context, js JSEngine) error {
+	body := &WF{Name: s.Name + ".try", Steps: cloneSteps(s.Try), Variables: make(map[string]interface{})}
+	body.createActivitiesFromSteps()
+	err := body.run(ctx, js)
+	for k, v := range body.Variables {
+		s.Variables[k] = v
+	}
+	if err == nil {
+		return nil
+	}
+
+	kind := errorKind(err)
+	if s.Except == nil || kind == ERROR_KIND_JS_LIMIT || !(len(s.Except.Errors) == 0 || contains(s.Except.Errors, kind)) {
+		return err
+	}
+	log.Println("EXCEPT: ", s.Name, kind, err)
+
+	bs, _ := json.Marshal(errorObject(err))
+	as := s.Except.As
+	if as == "" {
+		as = "error"
+	}
+	runJS(as+" = "+string(bs)+";", js, "except")
+
+	handler := &WF{Name: s.Name + ".except", Steps: cloneSteps(s.Except.Steps), Variables: make(map[string]interface{})}
+	handler.createActivitiesFromSteps()
+	err = handler.run(ctx, js)
+	for k, v := range handler.Variables {
+		s.Variables[k] = v
+	}
+	return err
+}
+
+// Block until the signal args.name (default: the step name) is received and return its JSON payload. With
+// args.timeout (seconds) the step ends with a null result and jumps to timeout_next when the timer fires first, without
+// a timeout_next it fails with a TimeoutError
+func (s *Step) waitSignal(ctx workflow.Context) (string, error) {
+	name := toString(s.Args["name"])
+	if name == "" {
+		name = s.Name
+	}
+	timeout, _ := strconv.ParseFloat(toString(s.Args["timeout"]), 64)
+	s.jump = ""
+
+	var payload json.RawMessage
+	received := false
+	selector := workflow.NewSelector(ctx)
+	selector.AddReceive(workflow.GetSignalChannel(ctx, name), func(c workflow.ReceiveChannel, more bool) {
+		c.Receive(ctx, &payload)
+		received = true
+	})
+	selector.AddReceive(ctx.Done(), func(c workflow.ReceiveChannel, more bool) {})
+
+	tctx, cancel := workflow.WithCancel(ctx)
+	defer cancel() // Stop the timer once the signal is in
+	if timeout > 0 {
+		selector.AddFuture(workflow.NewTimer(tctx, time.Duration(timeout*float64(time.Second))), func(f workflow.Future) {})
+	}
+
+	log.Println("WAIT SIGNAL: ", name, timeout)
+	selector.Select(ctx)
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if !received {
+		log.Println("WAIT SIGNAL: timed out ", name)
+		if s.Timeout_next == "" {
+			return "", temporal.NewNonRetryableApplicationError("no signal "+name+" within "+toString(s.Args["timeout"])+"s", ERROR_KIND_TIMEOUT, nil)
+		}
+		s.jump = s.Timeout_next
+		return "null", nil
+	}
+	if len(payload) == 0 {
+		return "null", nil
+	}
+	return string(payload), nil
+}
+
+// Run the finally steps with the outcome of the run bound to the JS variable WORKFLOW { status, error }. After a cancel
+// they run in a disconnected ctx, otherwise their activities would be canceled right away
+func (wf *WF) runFinally(ctx workflow.Context, js JSEngine, runErr error) error {
+	outcome := map[string]interface{}{"status": "completed", "error": nil}
+	if runErr != nil {
+		outcome["status"] = "failed"
+		outcome["error"] = errorObject(runErr)
+	}
+	if ctx.Err() != nil || temporal.IsCanceledError(runErr) {
+		outcome["status"] = "canceled"
+		ctx, _ = workflow.NewDisconnectedContext(ctx)
+	}
+	log.Println("FINALLY: ", wf.Name, outcome["status"])
+	bs, _ := json.Marshal(outcome)
+	runJS("WORKFLOW = "+string(bs)+";", js, "finally")
+
+	finally := &WF{Name: wf.Name + ".finally", Steps: cloneSteps(wf.Finally), Variables: make(map[string]interface{})}
+	finally.createActivitiesFromSteps()
+	err := finally.run(ctx, js)
+	for k, v := range finally.Variables {
+		wf.Variables[k] = v
+	}
+	return err
+}
+
+func (r *RetryT) policy() *temporal.RetryPolicy {
+	policy := &temporal.RetryPolicy{
+		InitialInterval:        time.Second,
+		BackoffCoefficient:     2, // Temporal's default, 0 is rejected
+		MaximumInterval:        time.Duration(r.MaxInterval) * time.Second,
+		MaximumAttempts:        r.MaxAttempts,
+		NonRetryableErrorTypes: r.NonRetryable,
+	}
+	if r.InitialInterval > 0 {
+		policy.InitialInterval = time.Duration(r.InitialInterval) * time.Second
+	}
+	if r.BackoffCoefficient > 0 {
+		policy.BackoffCoefficient = r.BackoffCoefficient
+	}
+	return policy
+}
+
+// Re-assign the loop variables of the current iteration (if any). Needed whenever the workflow may have switched to
+// another iteration, as iterations run one at a time share one JS context
+func bindScope(ctx workflow.Context, js JSEngine) {
+	scope, _ := ctx.Value(scopeKey{}).(string)
+	if scope != "" {
+		runJS(scope, js, "scope")
+	}
+}
+
+// Deep copy of steps, as executing a step writes into it (args, variables)
+func cloneSteps(steps []*Step) []*Step {
+	var clone []*Step
+	bs, _ := json.Marshal(steps)
+	json.Unmarshal(bs, &clone)
+	return clone
+}
+
 func executeAsync(exe executable, ctx workflow.Context, jsvm *otto.Otto, bindings map[string]string) workflow.Future {
 	future, settable := workflow.NewFuture(ctx)
 	workflow.Go(ctx, func(ctx workflow.Context) {
@@ -463,22 +1008,24 @@ func executeAsync(exe executable, ctx workflow.Context, jsvm *otto.Otto, binding
 	return future
 }
 
-// Run JS code in v8 and return result
-func runJS(code string, v8 *v8go.Context, ref string) (string, error) {
-	val, err := v8.RunScript(code, ref)
-	log.Println("RUNJS:"+strings.ToUpper(ref)+" code => "+code, "err => ", err)
+// Run JS code in js and return result
+func runJS(code string, js JSEngine, ref string) (string, error) {
+	val, err := js.Eval(code, ref)
 	if err != nil {
-		code = "ERRORS.push(JSON.stringify(" + err.Error() + "));"
-		v8.RunScript(code, ref+".error.js")
+		recordJSError(js, ref, err)
 		return "", err
 	}
-	return val.String(), nil
+	return val, nil
 }
 
 func makeInput(argNames []string, argsMap map[string]string) []string {
 	var args []string
 	for _, arg := range argNames {
-		args = append(args, argsMap[arg])
+		v, ok := argsMap[arg]
+		if !ok {
+			v = arg // literal value
+		}
+		args = append(args, v)
 	}
 	return args
 }
@@ -487,7 +1034,7 @@ func getStringFromJSON(raw json.RawMessage) string {
 	bs, err := json.Marshal(raw)
 	if err == nil {
 		str := string(bs)
-		if str != "null" || str != "" {
+		if str != "null" && str != "" {
 			str = UnEscapeStr(str)
 			return str
 		}
@@ -549,7 +1096,7 @@ func loadZSrc() error {
 	Z_SRC = "console.log('no z.min.js');"
 	data, err := ioutil.ReadFile("./z.min.js")
 	if err != nil {
-		fmt.Println(err)
+		log.Println(err)
 		log.Println("COULDN'T LOAD JS SOURCE")
 		return err
 	}
@@ -560,4 +1107,12 @@ func loadZSrc() error {
 
 func InitWorkflowGlobals() {
 	loadZSrc()
+
+	JS_ENGINE = os.Getenv("JS_ENGINE") // v8go, goja or otto
+	log.Println("JS engine: ", JS_ENGINE)
+	loadJSLimits()
+
+	if dir := os.Getenv("DEFINITIONS_DIR"); dir != "" {
+		DEFINITIONS_DIR = dir
+	}
 }
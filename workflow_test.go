@@ -1,22 +1,262 @@
 package app
 
-// import (
-// 	"testing"
-
-// 	"github.com/stretchr/testify/mock"
-// 	"github.com/stretchr/testify/require"
-// 	"go.temporal.io/sdk/testsuite"
-// )
-
-// func Test_Workflow(t *testing.T) {
-// 	testSuite := &testsuite.WorkflowTestSuite{}
-// 	env := testSuite.NewTestWorkflowEnvironment()
-// 	// Mock activity implementation
-// 	env.OnActivity(CallHttp, mock.Anything).Return("Hello World!", nil)
-// 	env.ExecuteWorkflow(MegaWorkflow, "World")
-// 	require.True(t, env.IsWorkflowCompleted())
-// 	require.NoError(t, env.GetWorkflowError())
-// 	var greeting string
-// 	require.NoError(t, env.GetWorkflowResult(&greeting))
-// 	require.Equal(t, "Hello World!", greeting)
-// }
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+)
+
+// Activities of a test run by step call. Calls without a mock run the real activity
+type testMocks map[string]func(step *Step) (string, error)
+
+// Run a definition on the Temporal test environment like the worker does. Returns the result as JSON
+func runTestWF(t *testing.T, def string, mocks testMocks) (string, error) {
+	t.Helper()
+	return runTestWFEngine(t, "", def, mocks)
+}
+
+// Like runTestWF with the JS engine of that name, "" is the one of JS_ENGINE
+func runTestWFEngine(t *testing.T, engine string, def string, mocks testMocks) (string, error) {
+	t.Helper()
+	InitWorkflowGlobals()
+	if engine != "" {
+		JS_ENGINE = engine
+		defer func() { JS_ENGINE = "" }()
+	}
+	wf, err := NEW_WF([]byte(def))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(WorkflowEngineMain)
+	a := &ActivityType{}
+	activities := map[string]func(ctx context.Context, step *Step) (string, error){
+		"NopActivity": a.NopActivity,
+		"CallHttp":    a.CallHttp,
+		"HttpRequest": a.HttpRequest,
+	}
+	for name, real := range activities {
+		real := real
+		env.RegisterActivityWithOptions(func(ctx context.Context, step *Step) (string, error) {
+			if mock, ok := mocks[step.Call]; ok {
+				return mock(step)
+			}
+			return real(ctx, step)
+		}, activity.RegisterOptions{Name: name})
+	}
+	env.RegisterActivity(a.LoadDefinition)
+
+	env.ExecuteWorkflow(WorkflowEngineMain, wf)
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("workflow didn't complete")
+	}
+	if err := env.GetWorkflowError(); err != nil {
+		return "", err
+	}
+	var res interface{}
+	if err := env.GetWorkflowResult(&res); err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := json.Marshal(res)
+	return string(bs), nil
+}
+
+func TestParallel(t *testing.T) {
+	def := `{"name":"P","steps":[
+		{"name":"fanout","parallel":{"branches":[
+			{"name":"a","steps":[{"name":"getA","call":"http.post","args":{"url":"http://a"},"result":"ra"}]},
+			{"name":"b","steps":[{"name":"setB","assign":{"rb":"'b'"}},{"name":"nop","call":"noops","result":"nb"}]}
+		]},"result":"joined"},
+		{"name":"done","return":"({a: joined.a.ra.id, b: nb, rb: rb})"}]}`
+	res, err := runTestWF(t, def, testMocks{
+		"http.post": func(step *Step) (string, error) { return `{"id": 7}`, nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != `{"a":7,"b":"Result_NopActivity","rb":"b"}` {
+		t.Error(res)
+	}
+}
+
+func TestParallelBranchFails(t *testing.T) {
+	def := `{"name":"P","steps":[
+		{"name":"fanout","parallel":{"branches":[
+			{"name":"ok","steps":[{"name":"nop","call":"noops"}]},
+			{"name":"broken","steps":[{"name":"post","call":"http.post","args":{"url":"http://b"}}]}
+		]}},
+		{"name":"done","return":"1"}]}`
+	_, err := runTestWF(t, def, testMocks{
+		"http.post": func(step *Step) (string, error) { return "", errors.New("connection refused") },
+	})
+	if err == nil || !strings.Contains(err.Error(), "parallel branch broken") {
+		t.Error(err)
+	}
+}
+
+// Concurrent iterations wait on their activities at the same time, none of them must see the variables of another
+func TestForConcurrentIterationsKeepTheirVariables(t *testing.T) {
+	def := `{"name":"F","steps":[
+		{"name":"init","assign":{"items":"[1, 2, 3]","outer":"'o'"}},
+		{"name":"each","for":{"in":"items","value":"it","index":"i","concurrency":3},"children":[
+			{"name":"set","assign":{"mine":"it * 10"}},
+			{"name":"post","call":"http.post","args":{"url":"http://x/${it}"},"result":"res"},
+			{"name":"ret","return":"({it: it, i: i, mine: mine, res: res.n, outer: outer})"}
+		],"result":"all"},
+		{"name":"done","return":"({all: all, mine: typeof mine})"}]}`
+	res, err := runTestWF(t, def, testMocks{
+		"http.post": func(step *Step) (string, error) {
+			return `{"n": "` + step.Args["url"].(string) + `"}`, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"all":[` +
+		`{"i":0,"it":1,"mine":10,"outer":"o","res":"http://x/1"},` +
+		`{"i":1,"it":2,"mine":20,"outer":"o","res":"http://x/2"},` +
+		`{"i":2,"it":3,"mine":30,"outer":"o","res":"http://x/3"}],"mine":"undefined"}`
+	if res != expected {
+		t.Error(res)
+	}
+}
+
+// One at a time the iterations share the variables of the workflow
+func TestForSequentialIterationsShareVariables(t *testing.T) {
+	def := `{"name":"F","steps":[
+		{"name":"init","assign":{"total":"0"}},
+		{"name":"each","for":{"in":"[1, 2, 3, 4]"},"children":[
+			{"name":"nop","call":"noops"},
+			{"name":"add","assign":{"total":"total + item"}}
+		]},
+		{"name":"done","return":"total"}]}`
+	res, err := runTestWF(t, def, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != `10` {
+		t.Error(res)
+	}
+}
+
+func TestForNotAnArray(t *testing.T) {
+	def := `{"name":"F","steps":[{"name":"each","for":{"in":"({a: 1})"},"children":[{"name":"nop","call":"noops"}]}]}`
+	_, err := runTestWF(t, def, nil)
+	if err == nil || !strings.Contains(err.Error(), "is not an array") {
+		t.Error(err)
+	}
+}
+
+// An expression that throws fails the run with a JSError once its steps are done, one detail per error
+func TestJSErrorsFailTheRun(t *testing.T) {
+	for name, step := range map[string]string{
+		"assign": `{"name":"s","assign":{"x":"missing + 1"}}`,
+		"args":   `{"name":"s","call":"noops","args":{"v":"${missing.field}"}}`,
+		"match":  `{"name":"s","match":{"on":"missing","conditions":["(x) => 1"]}}`,
+		"return": `{"name":"s","return":"({ v: missing })"}`,
+	} {
+		def := `{"name":"E","steps":[` + step + `,{"name":"after","assign":{"y":"1"}}]}`
+		_, err := runTestWF(t, def, nil)
+		var appErr *temporal.ApplicationError
+		if !errors.As(err, &appErr) || appErr.Type() != ERROR_KIND_JS {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		var details []string
+		if err := appErr.Details(&details); err != nil || len(details) != 1 {
+			t.Error(name, details, err)
+			continue
+		}
+		if !strings.HasPrefix(details[0], "step s: "+name) || !strings.Contains(details[0], "missing") {
+			t.Error(name, details[0])
+		}
+	}
+}
+
+// Errors of concurrent iterations are reported too
+func TestJSErrorsInIterations(t *testing.T) {
+	def := `{"name":"E","steps":[
+		{"name":"each","for":{"in":"[1, 2]","concurrency":2},"children":[{"name":"bad","assign":{"x":"item.a.b"}}]}]}`
+	_, err := runTestWF(t, def, nil)
+	var appErr *temporal.ApplicationError
+	var details []string
+	if !errors.As(err, &appErr) || appErr.Type() != ERROR_KIND_JS || appErr.Details(&details) != nil || len(details) != 2 {
+		t.Error(err, details)
+	}
+}
+
+func TestOutputErrorDetails(t *testing.T) {
+	def := `{"name":"O","output":{"type":"object","properties":{"a":{"type":"number"},"b":{"type":"string"}}},
+		"steps":[{"name":"done","return":"({ a: 'x', b: 1 })"}]}`
+	_, err := runTestWF(t, def, nil)
+	var appErr *temporal.ApplicationError
+	var details []string
+	if !errors.As(err, &appErr) || appErr.Type() != ERROR_KIND_OUTPUT || appErr.Details(&details) != nil || len(details) != 2 {
+		t.Error(err, details)
+	}
+}
+
+// Finally steps see the failure in WORKFLOW and the run keeps its error
+func TestFinallyOnFailure(t *testing.T) {
+	def := `{"name":"F","steps":[
+		{"name":"charge","call":"noops"},
+		{"name":"never","call":"http.put","args":{"url":"http://x"}}],
+		"finally":[{"name":"cleanup","call":"http.post","args":{"url":"http://x","body":{"status":"${WORKFLOW.status}","step":"${WORKFLOW.error.step}"}}}]}`
+	var cleanup map[string]interface{}
+	_, err := runTestWF(t, def, testMocks{
+		"noops": func(step *Step) (string, error) {
+			return "", temporal.NewNonRetryableApplicationError("declined", "", nil)
+		},
+		"http.put": func(step *Step) (string, error) { return "", errors.New("the step after the failure ran") },
+		"http.post": func(step *Step) (string, error) {
+			cleanup = step.Args["body"].(map[string]interface{})
+			return "{}", nil
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "declined") {
+		t.Error(err)
+	}
+	if cleanup["status"] != "failed" || cleanup["step"] != "charge" {
+		t.Error(cleanup)
+	}
+}
+
+// After a cancel the finally steps run on a disconnected context, their activities aren't canceled too
+func TestFinallyOnCancel(t *testing.T) {
+	InitWorkflowGlobals()
+	wf, err := NEW_WF([]byte(`{"name":"C","steps":[
+		{"name":"wait","call":"sleep","args":{"seconds":3600}},
+		{"name":"never","call":"http.put","args":{"url":"http://x"}}],
+		"finally":[{"name":"compensate","call":"http.post","args":{"url":"http://x","body":{"status":"${WORKFLOW.status}"}}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(WorkflowEngineMain)
+	calls := []string{}
+	status := ""
+	env.RegisterActivityWithOptions(func(ctx context.Context, step *Step) (string, error) {
+		calls = append(calls, step.Name)
+		status, _ = step.Args["body"].(map[string]interface{})["status"].(string)
+		return "{}", nil
+	}, activity.RegisterOptions{Name: "HttpRequest"})
+	env.RegisterDelayedCallback(env.CancelWorkflow, time.Minute)
+	env.ExecuteWorkflow(WorkflowEngineMain, wf)
+
+	if !env.IsWorkflowCompleted() || !temporal.IsCanceledError(env.GetWorkflowError()) {
+		t.Fatal(env.GetWorkflowError())
+	}
+	if strings.Join(calls, ",") != "compensate" || status != "canceled" {
+		t.Error(calls, status)
+	}
+}
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Content types of YAML request bodies
+var YAML_CONTENT_TYPES = []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"}
+
+// Line and column of the values of a YAML document by their lower case JSON path, e.g. steps[2].next
+type YAMLPositions map[string][2]int
+
+// .yaml and .yml files
+func IsYAMLFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+func IsYAMLContentType(contentType string) bool {
+	contentType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	return contains(YAML_CONTENT_TYPES, strings.ToLower(contentType))
+}
+
+// Parse a YAML definition like NEW_WF. Validation errors have the line and column of the offending value
+func NEW_WF_YAML(yaml_bytes []byte) (WF, error) {
+	json_bytes, positions, err := YAML_TO_JSON(yaml_bytes)
+	if err != nil {
+		return WF{}, ValidationErrors{{Message: err.Error(), Severity: SEVERITY_ERROR}}
+	}
+	wf, err := NEW_WF(json_bytes)
+	var errs ValidationErrors
+	if errors.As(err, &errs) {
+		return wf, positions.Locate(errs, "")
+	}
+	return wf, err
+}
+
+// Like VALIDATE_WF, with line and column numbers
+func VALIDATE_WF_YAML(yaml_bytes []byte) ValidationErrors {
+	json_bytes, positions, err := YAML_TO_JSON(yaml_bytes)
+	if err != nil {
+		return ValidationErrors{{Message: err.Error(), Severity: SEVERITY_ERROR}}
+	}
+	return positions.Locate(VALIDATE_WF(json_bytes), "")
+}
+
+// Convert a YAML document to JSON, keeping the order of the keys (assign runs in that order)
+func YAML_TO_JSON(yaml_bytes []byte) ([]byte, YAMLPositions, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(yaml_bytes, &doc)
+	if err != nil {
+		return nil, nil, errors.New("invalid yaml: " + strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, errors.New("invalid yaml: empty document")
+	}
+	c := &yamlConverter{positions: make(YAMLPositions)}
+	err = c.write(doc.Content[0], "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.buf.Bytes(), c.positions, nil
+}
+
+// Set the line and column of errors found in the document. prefix is the path of the definition in the document, e.g.
+// "definition." when it's wrapped
+func (p YAMLPositions) Locate(errs ValidationErrors, prefix string) ValidationErrors {
+	for i, e := range errs {
+		path := strings.ToLower(prefix + e.Path)
+		for {
+			if pos, ok := p[strings.TrimSuffix(path, ".")]; ok {
+				errs[i].Line, errs[i].Column = pos[0], pos[1]
+				break
+			}
+			cut := strings.LastIndexAny(path, ".[")
+			if cut <= 0 {
+				break
+			}
+			path = path[:cut]
+		}
+	}
+	return errs
+}
+
+type yamlConverter struct {
+	buf       bytes.Buffer
+	positions YAMLPositions
+}
+
+func (c *yamlConverter) write(n *yaml.Node, path string) error {
+	c.positions[strings.ToLower(path)] = [2]int{n.Line, n.Column}
+	switch n.Kind {
+	case yaml.AliasNode:
+		return c.write(n.Alias, path)
+	case yaml.DocumentNode:
+		return c.write(n.Content[0], path)
+	case yaml.SequenceNode:
+		c.buf.WriteByte('[')
+		for i, item := range n.Content {
+			if i > 0 {
+				c.buf.WriteByte(',')
+			}
+			if err := c.write(item, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		c.buf.WriteByte(']')
+		return nil
+	case yaml.MappingNode:
+		return c.writeMapping(n, path)
+	}
+	return c.writeScalar(n)
+}
+
+func (c *yamlConverter) writeMapping(n *yaml.Node, path string) error {
+	pairs := mappingPairs(n)
+	c.buf.WriteByte('{')
+	for i, pair := range pairs {
+		if i > 0 {
+			c.buf.WriteByte(',')
+		}
+		key := pair[0].Value
+		bs, _ := json.Marshal(key)
+		c.buf.Write(bs)
+		c.buf.WriteByte(':')
+		child := key
+		if path != "" {
+			child = path + "." + key
+		}
+		if err := c.write(pair[1], child); err != nil {
+			return err
+		}
+	}
+	c.buf.WriteByte('}')
+	return nil
+}
+
+// Key/value nodes of a mapping, with << merge keys expanded. Keys written in the mapping win over merged ones
+func mappingPairs(n *yaml.Node) [][2]*yaml.Node {
+	var pairs [][2]*yaml.Node
+	seen := make(map[string]bool)
+	var merged [][2]*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Tag == "!!merge" {
+			if v.Kind == yaml.AliasNode {
+				v = v.Alias
+			}
+			sources := []*yaml.Node{v}
+			if v.Kind == yaml.SequenceNode {
+				sources = v.Content
+			}
+			for _, src := range sources {
+				if src.Kind == yaml.AliasNode {
+					src = src.Alias
+				}
+				if src.Kind == yaml.MappingNode {
+					merged = append(merged, mappingPairs(src)...)
+				}
+			}
+			continue
+		}
+		seen[k.Value] = true
+		pairs = append(pairs, [2]*yaml.Node{k, v})
+	}
+	for _, pair := range merged {
+		if !seen[pair[0].Value] {
+			seen[pair[0].Value] = true
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// Numbers, booleans and null keep their type, everything else (timestamps too) is a string
+func (c *yamlConverter) writeScalar(n *yaml.Node) error {
+	var v interface{}
+	switch n.ShortTag() {
+	case "!!int", "!!float", "!!bool", "!!null":
+		if err := n.Decode(&v); err != nil {
+			return errors.New("line " + strconv.Itoa(n.Line) + ": " + err.Error())
+		}
+	default:
+		v = n.Value
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		// .inf and .nan have no JSON
+		return errors.New("line " + strconv.Itoa(n.Line) + ": " + strconv.Quote(n.Value) + " can't be converted to JSON")
+	}
+	c.buf.Write(bs)
+	return nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	for _, c := range []struct {
+		yaml     string
+		expected string
+	}{
+		// Keys keep their order, numbers, booleans and null their type, anything else is a string
+		{"b: 1\na: true\nc: ~\nd: 2021-01-02\ne: '3'\n", `{"b":1,"a":true,"c":null,"d":"2021-01-02","e":"3"}`},
+		{"steps:\n  - name: a\n    assign:\n      z: 1\n      y: z + 1\n", `{"steps":[{"name":"a","assign":{"z":1,"y":"z + 1"}}]}`},
+		// Block scalars keep the new lines
+		{"return: |\n  a +\n  b\n", `{"return":"a +\nb\n"}`},
+		// Merge keys, the keys of the mapping win and the merged ones follow them
+		{"base: &b {x: 1, y: 2}\nstep:\n  <<: *b\n  y: 3\n", `{"base":{"x":1,"y":2},"step":{"y":3,"x":1}}`},
+		{"a: &a {x: 1}\nb: &b {y: 2}\nc: {<<: [*a, *b]}\n", `{"a":{"x":1},"b":{"y":2},"c":{"x":1,"y":2}}`},
+	} {
+		bs, _, err := YAML_TO_JSON([]byte(c.yaml))
+		if err != nil || string(bs) != c.expected {
+			t.Errorf("%q\n got: %s %v\nwant: %s", c.yaml, bs, err, c.expected)
+		}
+	}
+}
+
+func TestYAMLToJSONErrors(t *testing.T) {
+	for _, c := range []struct {
+		yaml     string
+		expected string
+	}{
+		{"", "invalid yaml: empty document"},
+		{"a: [1, 2\n", "invalid yaml:"},
+		{"a: 1\nb: .inf\n", `line 2: ".inf" can't be converted to JSON`},
+		{"a: .nan\n", `line 1: ".nan" can't be converted to JSON`},
+	} {
+		_, _, err := YAML_TO_JSON([]byte(c.yaml))
+		if err == nil || !strings.HasPrefix(err.Error(), c.expected) {
+			t.Errorf("%q: got %v, want %s", c.yaml, err, c.expected)
+		}
+	}
+}
+
+func TestYAMLPositions(t *testing.T) {
+	_, positions, err := YAML_TO_JSON([]byte("name: w\nsteps:\n  - name: a\n    Next: b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if positions["steps[0].next"] != [2]int{4, 11} || positions["steps[0]"] != [2]int{3, 5} || positions["name"] != [2]int{1, 7} {
+		t.Error(positions)
+	}
+
+	// Errors without a position of their own get the one of their closest parent, with the prefix of a wrapper
+	errs := positions.Locate(ValidationErrors{
+		{Path: "steps[0].next", Message: "x"},
+		{Path: "steps[0].args.url", Message: "y"},
+		{Path: "other", Message: "z"},
+	}, "")
+	if errs[0].Line != 4 || errs[0].Column != 11 || errs[1].Line != 3 || errs[1].Column != 5 || errs[2].Line != 0 {
+		t.Error(errs)
+	}
+	_, wrapped, _ := YAML_TO_JSON([]byte("definition:\n  steps:\n    - name: a\n"))
+	errs = wrapped.Locate(ValidationErrors{{Path: "steps[0].name", Message: "x"}}, "definition.")
+	if errs[0].Line != 3 || errs[0].Column != 13 {
+		t.Error(errs)
+	}
+}
+
+func TestNewWFYAML(t *testing.T) {
+	wf, err := NEW_WF_YAML([]byte("name: ok\nsteps:\n  - name: a\n    return: '1'\n"))
+	if err != nil || wf.Name != "ok" {
+		t.Fatal(wf.Name, err)
+	}
+
+	_, err = NEW_WF_YAML([]byte("name: bad\nsteps:\n  - name: a\n    next: nowhere\n"))
+	errs, ok := err.(ValidationErrors)
+	if !ok || len(errs) != 1 || errs[0].Path != "steps[0].next" || errs[0].Line != 4 || errs[0].Column != 11 {
+		t.Fatal(err)
+	}
+
+	errs = VALIDATE_WF_YAML([]byte("steps: [1, 2\n"))
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Message, "invalid yaml:") {
+		t.Error(errs)
+	}
+}
+
+func TestIsYAML(t *testing.T) {
+	for name, expected := range map[string]bool{"a.yaml": true, "b.YML": true, "c.json": false, "yaml": false} {
+		if IsYAMLFile(name) != expected {
+			t.Error(name)
+		}
+	}
+	for contentType, expected := range map[string]bool{
+		"application/yaml": true, "text/x-yaml; charset=utf-8": true, "Application/X-YAML": true, "application/json": false,
+	} {
+		if IsYAMLContentType(contentType) != expected {
+			t.Error(contentType)
+		}
+	}
+}